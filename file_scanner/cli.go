@@ -0,0 +1,818 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Exit codes returned by the command line interface.
+const (
+	exitOK         = 0
+	exitScanError  = 1
+	exitUsage      = 2
+	exitConnection = 3
+	exitCancelled  = 130
+)
+
+// cliConfig is everything a headless command needs. Values are resolved in
+// order of precedence: flags, FILE_SCANNER_* environment variables, the JSON
+// config file, then the connection profile named by -profile.
+type cliConfig struct {
+	Backend          string        `json:"backend"`
+	Server           string        `json:"server"`
+	Port             string        `json:"port"`
+	Username         string        `json:"username"`
+	Password         string        `json:"password"`
+	Auth             string        `json:"auth"`
+	Realm            string        `json:"realm"`
+	Krb5Config       string        `json:"krb5_config"`
+	Keytab           string        `json:"keytab"`
+	TenantID         string        `json:"tenant_id"`
+	Encrypt          string        `json:"encrypt"`
+	TrustServerCert  bool          `json:"trust_server_cert"`
+	TLSCA            string        `json:"tls_ca"`
+	TLSHostname      string        `json:"tls_hostname"`
+	TLSPin           string        `json:"tls_pin"`
+	SSLMode          string        `json:"sslmode"`
+	Database         string        `json:"database"`
+	Table            string        `json:"table"`
+	Folder           string        `json:"folder"`
+	HashAlgorithm    string        `json:"hash_algorithm"`
+	HashRateMB       float64       `json:"hash_rate_mb"`
+	Incremental      bool          `json:"incremental"`
+	PurgeDeleted     bool          `json:"purge_deleted"`
+	ExtractContent   bool          `json:"extract_content"`
+	DetectMIME       bool          `json:"detect_mime"`
+	Filters          FilterRules   `json:"filters"`
+	Format           string        `json:"format"`
+	Output           string        `json:"output"`
+	Compression      string        `json:"compression"`
+	RotateSize       int64         `json:"rotate_size"`
+	ProgressInterval time.Duration `json:"-"`
+	Verbose          bool          `json:"-"`
+	DryRun           bool          `json:"-"`
+}
+
+func (c cliConfig) connection() ConnectionConfig {
+	return ConnectionConfig{
+		Backend:  c.Backend,
+		Server:   c.Server,
+		Port:     c.Port,
+		Username: c.Username,
+		Password: c.Password,
+		Database: c.Database,
+		// SQL Server logins other than with Username and Password.
+		Auth:       c.Auth,
+		Realm:      c.Realm,
+		Krb5Config: c.Krb5Config,
+		Keytab:     c.Keytab,
+		TenantID:   c.TenantID,
+		// SQL Server encryption.
+		Encrypt:         c.Encrypt,
+		TrustServerCert: c.TrustServerCert,
+		TLSCA:           c.TLSCA,
+		TLSHostname:     c.TLSHostname,
+		TLSPin:          c.TLSPin,
+		// PostgreSQL encryption.
+		SSLMode: c.SSLMode,
+		// Scans with the files backend write rows in the report format.
+		FileFormat:  c.Format,
+		Compression: c.Compression,
+		RotateSize:  c.RotateSize,
+	}
+}
+
+func (c cliConfig) scanOptions() ScanOptions {
+	return ScanOptions{
+		HashAlgorithm:  c.HashAlgorithm,
+		HashRateLimit:  int64(c.HashRateMB * 1024 * 1024),
+		Incremental:    c.Incremental,
+		PurgeDeleted:   c.PurgeDeleted,
+		Filters:        c.Filters,
+		ExtractContent: c.ExtractContent,
+		DetectMIME:     c.DetectMIME,
+	}
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, `Usage: file_scanner <command> [flags]
+
+Commands:
+  scan          Scan -folder into -table, creating the table if needed. Files
+                no longer found under -folder are marked deleted, or removed
+                with -purge-deleted
+  watch         Scan like 'scan', then keep -table current as files under
+                -folder change, until interrupted
+  resume        Resume the last unfinished scan
+  list-tables   List the tables in the database
+  create-table  Create -table (or the first argument) in the database
+  duplicates    Report files in -table with identical content as -format csv
+                or json, to -output or stdout. Same-size files without a
+                stored -hash are hashed first (default sha256)
+  export        Write the rows of -table as -format csv, ndjson or parquet to
+                -output or stdout. -folder limits the export to the rows below
+                it, and the filter flags to the files they would keep
+  import        Load a -format csv or ndjson file written by export or the
+                files backend (the first argument, or stdin) into -table,
+                inserting new paths and updating known ones. The file may be
+                gzip or zstd compressed. -dry-run only validates it and
+                counts the inserts and updates
+
+Scans can be limited with -include, -exclude, -ext, -exclude-ext, -min-size,
+-max-size, -modified-after, -modified-before and -prune. Files left out by a
+filter are never marked deleted.
+
+With -extract, scans also read the EXIF tags of photos, the page count, title
+and author of PDFs, the ID3 tags of MP3s and the document properties of Office
+files into the "content" field of other_metadata.
+
+With -mime, scans sniff each file's type from its first bytes into mime_type
+and set mime_mismatch where the extension disagrees, such as an executable
+named .jpg.
+
+Use -backend sqlite -database catalog.db to scan into a local SQLite file, or
+-backend postgres to scan into PostgreSQL instead of SQL Server.
+
+Use -backend files -database <directory> to scan into numbered -format csv or
+ndjson files named after -table instead of a database, compressed with
+-compress gzip or zstd. With -rotate-size a new file is started once one
+reaches that size, e.g. 1GB. File output cannot be read back, so it does not
+support -incremental, watch, duplicates, export or import. Its files can be
+imported into a database later.
+
+SQL Server logins are SQL logins with -user and -password unless -auth says
+otherwise:
+  integrated     the current user, through Windows SSPI or, elsewhere, the
+                 Kerberos ticket of kinit
+  kerberos       the principal -user with the -keytab file, or with -password
+                 without one. -krb5-config and -realm override the defaults
+                 of KRB5_CONFIG or /etc/krb5.conf
+  azure-sp       the Azure AD service principal with client ID -user in
+                 -tenant, with its client secret as -password
+  azure-msi      the managed identity of the Azure host, or the user-assigned
+                 one with client ID -user
+  azure-default  Azure AD credentials from AZURE_* environment variables,
+                 workload identity, managed identity or the Azure CLI
+
+SQL Server connections only encrypt the login unless -encrypt is mandatory,
+which encrypts everything, or strict, which uses TDS 8.0 and always starts
+with TLS; -encrypt disable turns encryption off. Encrypted connections check
+the server certificate against the system CAs, or the CA bundle in -tls-ca,
+and its host name against -server, or -tls-hostname. -tls-pin accepts only
+certificates with the given comma-separated SHA-256 fingerprints, as printed
+by 'openssl x509 -noout -fingerprint -sha256'. -trust-server-cert skips the
+CA and host name checks, so a self-signed certificate is only safe with
+-tls-pin.
+
+PostgreSQL connections use TLS without checking the server certificate unless
+-sslmode says otherwise: disable for servers without TLS, such as most local
+installs, verify-ca to check the certificate against the CA in PGSSLROOTCERT
+or ~/.postgresql/root.crt, or verify-full to also check that it names -server.
+
+Connection flags can also be set with FILE_SCANNER_BACKEND, FILE_SCANNER_SERVER,
+FILE_SCANNER_PORT, FILE_SCANNER_USER, FILE_SCANNER_PASSWORD,
+FILE_SCANNER_AUTH, FILE_SCANNER_REALM, FILE_SCANNER_KRB5_CONFIG,
+FILE_SCANNER_KEYTAB, FILE_SCANNER_TENANT, FILE_SCANNER_ENCRYPT,
+FILE_SCANNER_TLS_CA, FILE_SCANNER_TLS_HOSTNAME, FILE_SCANNER_TLS_PIN,
+FILE_SCANNER_SSLMODE, FILE_SCANNER_DATABASE, FILE_SCANNER_TABLE, FILE_SCANNER_FOLDER and
+FILE_SCANNER_CONFIG. Settings left unset are taken from the connection
+profile saved by the GUI that is named by -profile or FILE_SCANNER_PROFILE.
+Its password is only used with the server and user it was saved for; if it
+was saved with a master password, set FILE_SCANNER_MASTER_PASSWORD to
+decrypt it.
+
+Run 'file_scanner <command> -h' for the flags of a command.`)
+}
+
+// secretFlags are the flags whose values are kept out of the log.
+var secretFlags = []string{"password"}
+
+// redactArgs returns a copy of args with the values of secretFlags masked,
+// whether given as -flag value or -flag=value.
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+	for i := 0; i < len(redacted); i++ {
+		arg := redacted[i]
+		if arg == "--" {
+			break
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || !containsString(secretFlags, name) {
+			continue
+		}
+		if hasValue {
+			redacted[i] = arg[:strings.Index(arg, "=")+1] + "***"
+		} else if i+1 < len(redacted) {
+			i++
+			redacted[i] = "***"
+		}
+	}
+	return redacted
+}
+
+func runCLI(args []string) int {
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+
+	command, rest := args[0], args[1:]
+	switch command {
+	case "scan", "watch", "resume", "list-tables", "create-table", "duplicates", "export", "import":
+	case "help", "-h", "-help", "--help":
+		printUsage(os.Stdout)
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", command)
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+
+	cfg, fs, err := parseCLIFlags(command, rest)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	if cfg.Verbose {
+		log.SetOutput(&multiWriter{writers: []io.Writer{os.Stderr, logFile}})
+	}
+
+	if command == "create-table" && cfg.Table == "" && fs.NArg() > 0 {
+		cfg.Table = fs.Arg(0)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	store, err := openStorage(cfg.connection())
+	if err != nil {
+		log.Printf("Error connecting to database: %v", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitConnection
+	}
+	defer store.Close()
+
+	switch command {
+	case "scan":
+		return cliScan(ctx, store, cfg, false, false)
+	case "watch":
+		return cliScan(ctx, store, cfg, false, true)
+	case "resume":
+		return cliScan(ctx, store, cfg, true, false)
+	case "list-tables":
+		return cliListTables(store)
+	case "create-table":
+		return cliCreateTable(store, cfg)
+	case "duplicates":
+		return cliDuplicates(ctx, store, cfg)
+	case "export":
+		return cliExport(ctx, store, cfg)
+	case "import":
+		return cliImport(ctx, store, cfg, fs.Arg(0))
+	}
+	return exitUsage
+}
+
+func parseCLIFlags(command string, args []string) (cliConfig, *flag.FlagSet, error) {
+	var cfg cliConfig
+	var configPath string
+
+	settings := []struct {
+		flag, env, usage string
+		target           *string
+	}{
+		{"backend", "FILE_SCANNER_BACKEND", "storage backend: mssql, sqlite, postgres or files", &cfg.Backend},
+		{"server", "FILE_SCANNER_SERVER", "database server host", &cfg.Server},
+		{"port", "FILE_SCANNER_PORT", "database server port (default 1433, or 5432 for postgres)", &cfg.Port},
+		{"user", "FILE_SCANNER_USER", "database user", &cfg.Username},
+		{"password", "FILE_SCANNER_PASSWORD", "database password", &cfg.Password},
+		{"auth", "FILE_SCANNER_AUTH", "SQL Server login: sql, integrated, kerberos, azure-sp, azure-msi or azure-default", &cfg.Auth},
+		{"realm", "FILE_SCANNER_REALM", "Kerberos realm (default that of the krb5 config)", &cfg.Realm},
+		{"krb5-config", "FILE_SCANNER_KRB5_CONFIG", "Kerberos config file (default KRB5_CONFIG or /etc/krb5.conf)", &cfg.Krb5Config},
+		{"keytab", "FILE_SCANNER_KEYTAB", "Kerberos keytab file of -user", &cfg.Keytab},
+		{"tenant", "FILE_SCANNER_TENANT", "Azure AD tenant ID of the -auth azure-sp service principal", &cfg.TenantID},
+		{"encrypt", "FILE_SCANNER_ENCRYPT", "SQL Server encryption: disable, mandatory or strict (default the login only)", &cfg.Encrypt},
+		{"tls-ca", "FILE_SCANNER_TLS_CA", "PEM or DER CA bundle to check the server certificate against", &cfg.TLSCA},
+		{"tls-hostname", "FILE_SCANNER_TLS_HOSTNAME", "host name expected in the server certificate (default -server)", &cfg.TLSHostname},
+		{"tls-pin", "FILE_SCANNER_TLS_PIN", "comma-separated SHA-256 fingerprints of the accepted server certificates", &cfg.TLSPin},
+		{"sslmode", "FILE_SCANNER_SSLMODE", "PostgreSQL TLS: disable, require, verify-ca or verify-full (default require)", &cfg.SSLMode},
+		{"database", "FILE_SCANNER_DATABASE", "database name, the .db file for SQLite or the directory for files", &cfg.Database},
+		{"table", "FILE_SCANNER_TABLE", "table to scan into", &cfg.Table},
+		{"folder", "FILE_SCANNER_FOLDER", "folder or UNC path to scan", &cfg.Folder},
+	}
+
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	fs.StringVar(&configPath, "config", os.Getenv("FILE_SCANNER_CONFIG"), "path to a JSON config file")
+	profile := fs.String("profile", os.Getenv("FILE_SCANNER_PROFILE"), "saved connection profile to take unset settings from")
+	flagValues := make(map[string]*string)
+	for _, s := range settings {
+		flagValues[s.flag] = fs.String(s.flag, "", s.usage)
+	}
+	trustServerCert := fs.Bool("trust-server-cert", false, "don't check the server certificate's CA and host name")
+	hashAlgorithm := fs.String("hash", "", "hash file content with sha256, xxhash or blake3")
+	incremental := fs.Bool("incremental", false, "only write new or changed files")
+	purgeDeleted := fs.Bool("purge-deleted", false, "remove rows of deleted files instead of marking them")
+	extract := fs.Bool("extract", false, "read document, image and audio metadata from file content")
+	detectMIME := fs.Bool("mime", false, "detect file types from content and flag extension mismatches")
+	hashRate := fs.Float64("hash-rate", 0, "max MB/s read by all workers while hashing (0 = unlimited)")
+	include := fs.String("include", "", "comma-separated name or path globs; only matching files are scanned")
+	exclude := fs.String("exclude", "", "comma-separated name or path globs of files to skip")
+	extensions := fs.String("ext", "", "comma-separated extensions; only these are scanned")
+	excludeExtensions := fs.String("exclude-ext", "", "comma-separated extensions to skip")
+	minSize := fs.String("min-size", "", "skip files smaller than this, e.g. 10KB")
+	maxSize := fs.String("max-size", "", "skip files larger than this, e.g. 2GB")
+	modifiedAfter := fs.String("modified-after", "", "skip files modified before this date (YYYY-MM-DD)")
+	modifiedBefore := fs.String("modified-before", "", "skip files modified on or after this date (YYYY-MM-DD)")
+	pruneDirs := fs.String("prune", "", "comma-separated directory globs to skip, e.g. .git,node_modules")
+	format := fs.String("format", "", "report format: csv (default) or json, for export csv, ndjson or parquet, for files and import csv or ndjson")
+	compress := fs.String("compress", "", "compress file output with gzip or zstd")
+	rotateSize := fs.String("rotate-size", "", "start a new output file after this size, e.g. 1GB")
+	output := fs.String("output", "", "report or export file (default stdout)")
+	fs.DurationVar(&cfg.ProgressInterval, "progress-interval", 5*time.Second, "how often to print progress")
+	fs.BoolVar(&cfg.Verbose, "v", false, "also write the log to stderr")
+	fs.BoolVar(&cfg.DryRun, "dry-run", false, "validate an import and count its changes without writing")
+	if err := fs.Parse(args); err != nil {
+		return cfg, fs, err
+	}
+
+	if configPath != "" {
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			return cfg, fs, fmt.Errorf("error reading config file: %v", err)
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return cfg, fs, fmt.Errorf("error parsing config file: %v", err)
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok {
+			*s.target = value
+		}
+	}
+	var filterErr error
+	fs.Visit(func(f *flag.Flag) {
+		var err error
+		for _, s := range settings {
+			if s.flag == f.Name {
+				*s.target = *flagValues[f.Name]
+			}
+		}
+		switch f.Name {
+		case "trust-server-cert":
+			cfg.TrustServerCert = *trustServerCert
+		case "hash":
+			cfg.HashAlgorithm = *hashAlgorithm
+		case "hash-rate":
+			cfg.HashRateMB = *hashRate
+		case "incremental":
+			cfg.Incremental = *incremental
+		case "purge-deleted":
+			cfg.PurgeDeleted = *purgeDeleted
+		case "extract":
+			cfg.ExtractContent = *extract
+		case "mime":
+			cfg.DetectMIME = *detectMIME
+		case "include":
+			cfg.Filters.Include = splitList(*include)
+		case "exclude":
+			cfg.Filters.Exclude = splitList(*exclude)
+		case "ext":
+			cfg.Filters.Extensions = splitList(*extensions)
+		case "exclude-ext":
+			cfg.Filters.ExcludeExtensions = splitList(*excludeExtensions)
+		case "min-size":
+			cfg.Filters.MinSize, err = parseSize(*minSize)
+		case "max-size":
+			cfg.Filters.MaxSize, err = parseSize(*maxSize)
+		case "modified-after":
+			cfg.Filters.ModifiedAfter, err = parseDate(*modifiedAfter)
+		case "modified-before":
+			cfg.Filters.ModifiedBefore, err = parseDate(*modifiedBefore)
+		case "prune":
+			cfg.Filters.PruneDirs = splitList(*pruneDirs)
+		case "format":
+			cfg.Format = *format
+		case "output":
+			cfg.Output = *output
+		case "compress":
+			cfg.Compression = *compress
+		case "rotate-size":
+			cfg.RotateSize, err = parseSize(*rotateSize)
+		}
+		if err != nil && filterErr == nil {
+			filterErr = fmt.Errorf("-%s: %v", f.Name, err)
+		}
+	})
+	if filterErr != nil {
+		return cfg, fs, filterErr
+	}
+	if cfg.Format == "" {
+		cfg.Format = "csv"
+	}
+	if err := cfg.Filters.validate(); err != nil {
+		return cfg, fs, err
+	}
+	if err := validateHashAlgorithm(cfg.HashAlgorithm); err != nil {
+		return cfg, fs, err
+	}
+
+	// Settings left unset are taken from the -profile saved by the GUI, if
+	// one is named. Only the explicit settings are checked against the
+	// backend below: the profile's SQL Server options are left out when
+	// they don't apply.
+	explicit := cfg
+	if *profile != "" {
+		// A password saved with a master password is only available with
+		// FILE_SCANNER_MASTER_PASSWORD set.
+		saved, passwordStore, err := loadCredentials(*profile, os.Getenv("FILE_SCANNER_MASTER_PASSWORD"))
+		if errors.Is(err, errWrongMasterPassword) {
+			return cfg, fs, fmt.Errorf("FILE_SCANNER_MASTER_PASSWORD: %v", err)
+		}
+		if err != nil {
+			return cfg, fs, fmt.Errorf("-profile: %v", err)
+		}
+		if passwordStore == passwordVault && saved.Password == "" {
+			log.Printf("Saved password is encrypted; set FILE_SCANNER_MASTER_PASSWORD to use it")
+		}
+		applyProfile(&cfg, saved, *profile)
+	}
+
+	if explicit.Auth != "" && explicit.Auth != authSQL && cfg.Backend != "" && cfg.Backend != "mssql" {
+		return cfg, fs, fmt.Errorf("-auth %s is only supported by SQL Server", explicit.Auth)
+	}
+	if cfg.Auth != "" && !containsString(authModes, cfg.Auth) {
+		return cfg, fs, fmt.Errorf("unknown -auth %q; use one of %s", cfg.Auth, strings.Join(authModes, ", "))
+	}
+	if cfg.Encrypt != "" && !containsString(encryptModes, cfg.Encrypt) {
+		return cfg, fs, fmt.Errorf("unknown -encrypt %q; use one of %s", cfg.Encrypt, strings.Join(encryptModes, ", "))
+	}
+	if tlsSettingsSet(explicit) && cfg.Backend != "" && cfg.Backend != "mssql" {
+		return cfg, fs, fmt.Errorf("-encrypt and the certificate flags are only supported by SQL Server")
+	}
+	if explicit.SSLMode != "" && cfg.Backend != "postgres" {
+		return cfg, fs, fmt.Errorf("-sslmode is only supported by PostgreSQL")
+	}
+	if cfg.SSLMode != "" && !containsString(sslModes, cfg.SSLMode) {
+		return cfg, fs, fmt.Errorf("unknown -sslmode %q; use one of %s", cfg.SSLMode, strings.Join(sslModes, ", "))
+	}
+
+	switch cfg.Backend {
+	case "", "mssql", "postgres":
+		if cfg.Server == "" {
+			return cfg, fs, fmt.Errorf("no server given; use -server, FILE_SCANNER_SERVER or a config file")
+		}
+	case "sqlite":
+		if cfg.Database == "" {
+			return cfg, fs, fmt.Errorf("no database file given; use -database or FILE_SCANNER_DATABASE")
+		}
+	case "files":
+		if cfg.Database == "" {
+			return cfg, fs, fmt.Errorf("no output directory given; use -database or FILE_SCANNER_DATABASE")
+		}
+	}
+	return cfg, fs, nil
+}
+
+// tlsSettingsSet reports whether any SQL Server encryption setting is set.
+func tlsSettingsSet(cfg cliConfig) bool {
+	return cfg.Encrypt != "" || cfg.TrustServerCert || cfg.TLSCA != "" || cfg.TLSHostname != "" || cfg.TLSPin != ""
+}
+
+// applyProfile fills the settings cfg leaves unset from the saved profile.
+// The encryption settings are taken together, and only when none is set.
+// Options of other backends are skipped. The saved password is
+// only used to log in to the server, as the user, it was saved for.
+func applyProfile(cfg *cliConfig, saved ConnectionConfig, profile string) {
+	fill := func(value *string, savedValue string) {
+		if *value == "" {
+			*value = savedValue
+		}
+	}
+	fill(&cfg.Backend, saved.Backend)
+	fill(&cfg.Server, saved.Server)
+	fill(&cfg.Port, saved.Port)
+	fill(&cfg.Username, saved.Username)
+	fill(&cfg.Database, saved.Database)
+	fill(&cfg.Compression, saved.Compression)
+	if cfg.RotateSize == 0 {
+		cfg.RotateSize = saved.RotateSize
+	}
+
+	if cfg.Backend == "" || cfg.Backend == "mssql" {
+		fill(&cfg.Auth, saved.Auth)
+		fill(&cfg.Realm, saved.Realm)
+		fill(&cfg.Krb5Config, saved.Krb5Config)
+		fill(&cfg.Keytab, saved.Keytab)
+		fill(&cfg.TenantID, saved.TenantID)
+		if !tlsSettingsSet(*cfg) {
+			cfg.Encrypt = saved.Encrypt
+			cfg.TrustServerCert = saved.TrustServerCert
+			cfg.TLSCA = saved.TLSCA
+			cfg.TLSHostname = saved.TLSHostname
+			cfg.TLSPin = saved.TLSPin
+		}
+	}
+	if cfg.Backend == "postgres" {
+		fill(&cfg.SSLMode, saved.SSLMode)
+	}
+
+	if cfg.Password == "" && saved.Password != "" {
+		if cfg.Backend != saved.Backend || cfg.Server != saved.Server || cfg.Username != saved.Username {
+			log.Printf("Not using the password saved in profile '%s' for a different server or user", profile)
+			return
+		}
+		cfg.Password = saved.Password
+	}
+}
+
+func cliListTables(store Storage) int {
+	tables, err := store.ListCatalogs()
+	if err != nil {
+		log.Printf("Error getting tables: %v", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitScanError
+	}
+	for _, table := range tables {
+		fmt.Println(table)
+	}
+	return exitOK
+}
+
+func cliCreateTable(store Storage, cfg cliConfig) int {
+	if cfg.Table == "" {
+		fmt.Fprintln(os.Stderr, "Error: no table name given")
+		return exitUsage
+	}
+	if err := store.CreateCatalog(cfg.Table); err != nil {
+		log.Printf("Error creating table: %v", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitScanError
+	}
+	fmt.Printf("Table '%s' created or already exists\n", cfg.Table)
+	return exitOK
+}
+
+func cliDuplicates(ctx context.Context, store Storage, cfg cliConfig) int {
+	if cfg.Table == "" {
+		fmt.Fprintln(os.Stderr, "Error: no table name given")
+		return exitUsage
+	}
+	if cfg.Format != "csv" && cfg.Format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown report format %q\n", cfg.Format)
+		return exitUsage
+	}
+	reader, ok := store.(CatalogReader)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Error: this storage backend cannot be queried for duplicates")
+		return exitUsage
+	}
+
+	opts := cfg.scanOptions()
+	groups, err := findDuplicates(ctx, reader, cfg.Table, opts.HashAlgorithm, newRateLimiter(opts.HashRateLimit))
+	if err != nil {
+		log.Printf("Error finding duplicates: %v", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if errors.Is(err, context.Canceled) {
+			return exitCancelled
+		}
+		return exitScanError
+	}
+
+	var out io.Writer = os.Stdout
+	if cfg.Output != "" {
+		file, err := os.Create(cfg.Output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitScanError
+		}
+		defer file.Close()
+		out = file
+	}
+	if err := writeDuplicates(out, cfg.Format, groups); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitScanError
+	}
+
+	copies, wasted := duplicateTotals(groups)
+	fmt.Fprintf(os.Stderr, "%d duplicate groups, %d redundant copies, %s wasted\n",
+		len(groups), copies, formatBytes(wasted))
+	return exitOK
+}
+
+func cliExport(ctx context.Context, store Storage, cfg cliConfig) int {
+	if cfg.Table == "" {
+		fmt.Fprintln(os.Stderr, "Error: no table name given")
+		return exitUsage
+	}
+	reader, ok := store.(CatalogReader)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Error: this storage backend cannot be exported")
+		return exitUsage
+	}
+	known := false
+	for _, format := range exportFormats {
+		known = known || format == cfg.Format
+	}
+	if !known {
+		fmt.Fprintf(os.Stderr, "Error: unknown export format %q\n", cfg.Format)
+		return exitUsage
+	}
+
+	var out io.Writer = os.Stdout
+	if cfg.Output != "" {
+		file, err := os.Create(cfg.Output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitScanError
+		}
+		defer file.Close()
+		out = file
+	}
+	rows, err := exportCatalog(ctx, reader, cfg.Table, cfg.Folder, cfg.Filters, out, cfg.Format)
+	if err != nil {
+		log.Printf("Error exporting table: %v", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if errors.Is(err, context.Canceled) {
+			return exitCancelled
+		}
+		return exitScanError
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d rows from '%s'\n", rows, cfg.Table)
+	return exitOK
+}
+
+// cliImport loads the file at path, or stdin when path is empty or "-",
+// into the table.
+func cliImport(ctx context.Context, store Storage, cfg cliConfig, path string) int {
+	if cfg.Table == "" {
+		fmt.Fprintln(os.Stderr, "Error: no table name given")
+		return exitUsage
+	}
+	if !containsString(importFormats, cfg.Format) {
+		fmt.Fprintf(os.Stderr, "Error: unknown import format %q\n", cfg.Format)
+		return exitUsage
+	}
+
+	var in io.Reader = os.Stdin
+	if path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitScanError
+		}
+		defer file.Close()
+		in = file
+	}
+	summary, err := importCatalog(ctx, store, cfg.Table, in, cfg.Format, cfg.DryRun)
+	if err != nil {
+		log.Printf("Error importing into table: %v", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if errors.Is(err, context.Canceled) {
+			return exitCancelled
+		}
+		return exitScanError
+	}
+	if cfg.DryRun {
+		fmt.Fprintf(os.Stderr, "Dry run: %d rows would insert %d and update %d files in '%s'\n",
+			summary.Rows, summary.Inserts, summary.Updates, cfg.Table)
+		return exitOK
+	}
+	log.Printf("Imported %d rows into '%s': %d inserted, %d updated", summary.Rows, cfg.Table, summary.Inserts, summary.Updates)
+	fmt.Fprintf(os.Stderr, "Imported %d rows into '%s': %d inserted, %d updated\n",
+		summary.Rows, cfg.Table, summary.Inserts, summary.Updates)
+	return exitOK
+}
+
+// cliScan runs a scan to completion, printing progress to stdout. The scan
+// state is kept on failure or interruption so that 'resume' can pick it up.
+// With watch set the scan is followed by watch mode, which ends without an
+// error when ctx is cancelled.
+func cliScan(ctx context.Context, store Storage, cfg cliConfig, resume, watch bool) int {
+	scanStateLock.Lock()
+	if resume {
+		exists, err := scanStateExists()
+		if err == nil && !exists {
+			err = fmt.Errorf("there is no unfinished scan to resume")
+		}
+		if err == nil {
+			err = loadScanState()
+		}
+		if err != nil {
+			scanStateLock.Unlock()
+			log.Printf("Error loading scan state: %v", err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitUsage
+		}
+		if cfg.Table == "" {
+			cfg.Table = scanState.TableName
+		}
+		cfg.Folder = scanState.FolderPath
+	} else {
+		scanState = ScanState{Options: cfg.scanOptions()}
+	}
+	opts := scanState.Options
+	scanState.FolderPath = cfg.Folder
+	scanState.TableName = cfg.Table
+	if scanState.FilesScanned == nil {
+		scanState.FilesScanned = make(map[string]bool)
+	}
+	scanStateLock.Unlock()
+
+	if cfg.Table == "" || cfg.Folder == "" {
+		fmt.Fprintln(os.Stderr, "Error: both a table and a folder are required")
+		return exitUsage
+	}
+	if _, err := os.Stat(cfg.Folder); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: cannot access folder %s: %v\n", cfg.Folder, err)
+		return exitUsage
+	}
+	if err := store.CreateCatalog(cfg.Table); err != nil {
+		log.Printf("Error creating table: %v", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitScanError
+	}
+
+	fmt.Printf("Scanning %s into table '%s'\n", cfg.Folder, cfg.Table)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(cfg.ProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				printProgress(opts)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var err error
+	if watch {
+		err = watchFolder(ctx, store, cfg.Table, cfg.Folder, opts)
+	} else {
+		err = scanFolder(ctx, store, cfg.Table, cfg.Folder, opts)
+	}
+	close(done)
+	printProgress(opts)
+
+	if err != nil {
+		scanStateLock.Lock()
+		if saveErr := saveScanState(); saveErr != nil {
+			log.Printf("Error saving scan state: %v", saveErr)
+		}
+		scanStateLock.Unlock()
+		if errors.Is(err, context.Canceled) {
+			fmt.Fprintln(os.Stderr, "Scan interrupted; run 'file_scanner resume' to continue")
+			return exitCancelled
+		}
+		fmt.Fprintf(os.Stderr, "Error during scan: %v\n", err)
+		return exitScanError
+	}
+
+	if err := deleteScanState(); err != nil {
+		log.Printf("Error deleting scan state: %v", err)
+	}
+	if files, bytes := GetDeletionStats(); files > 0 {
+		action := "Marked"
+		if opts.PurgeDeleted {
+			action = "Removed"
+		}
+		fmt.Printf("%s %d deleted files (%s)\n", action, files, formatBytes(bytes))
+	}
+	if watch {
+		fmt.Println("Stopped watching")
+		return exitOK
+	}
+	fmt.Println("Scan completed successfully")
+	return exitOK
+}
+
+func printProgress(opts ScanOptions) {
+	filesScanned, filesWritten, scanSpeed, writeSpeed := GetProgressStats()
+	// An idle watch would otherwise repeat the same line forever.
+	if IsWatching() && scanSpeed == 0 && writeSpeed == 0 {
+		return
+	}
+	fmt.Printf("Progress: Scanned %d files, Written %d files, Scan speed: %.2f files/sec, Write speed: %.2f files/sec\n",
+		filesScanned, filesWritten, scanSpeed, writeSpeed)
+	if opts.Incremental {
+		newFiles, changedFiles, unchangedFiles := GetChangeStats()
+		fmt.Printf("Changes: %d new, %d changed, %d unchanged\n", newFiles, changedFiles, unchangedFiles)
+	}
+}
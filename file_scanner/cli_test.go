@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseCLIFlagsPrecedence(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	config := `{"backend": "sqlite", "database": "catalog.db", "format": "json", "output": "config.json", "table": "from_config"}`
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                   string
+		args                   []string
+		env                    string
+		wantFormat, wantOutput string
+		wantTable              string
+	}{
+		{"config only", []string{"-config", configPath}, "", "json", "config.json", "from_config"},
+		{"flags over config", []string{"-config", configPath, "-format", "csv", "-output", "report.csv", "-table", "from_flag"}, "", "csv", "report.csv", "from_flag"},
+		{"env over config", []string{"-config", configPath}, "from_env", "json", "config.json", "from_env"},
+		{"flag over env", []string{"-config", configPath, "-table", "from_flag"}, "from_env", "json", "config.json", "from_flag"},
+		{"defaults", []string{"-backend", "sqlite", "-database", "catalog.db"}, "", "csv", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("FILE_SCANNER_TABLE", test.env)
+			if test.env == "" {
+				os.Unsetenv("FILE_SCANNER_TABLE")
+			}
+			cfg, _, err := parseCLIFlags("duplicates", test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Format != test.wantFormat || cfg.Output != test.wantOutput || cfg.Table != test.wantTable {
+				t.Errorf("format %q, output %q, table %q; want %q, %q, %q",
+					cfg.Format, cfg.Output, cfg.Table, test.wantFormat, test.wantOutput, test.wantTable)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/argon2"
+)
+
+// Ways the saved credentials keep the password. Credentials saved before
+// these existed hold it in plain text and are migrated when loaded.
+const (
+	passwordKeyring = "keyring" // in the OS keyring
+	passwordVault   = "vault"   // in the profiles file, encrypted with a master password
+	passwordNone    = "none"    // not remembered
+)
+
+// keyringService is the keyring service saved passwords are filed under,
+// with the profile name as the account.
+const keyringService = "file_scanner"
+
+var errWrongMasterPassword = errors.New("wrong master password")
+
+// secretStore keeps passwords outside the credentials file.
+type secretStore interface {
+	Get(account string) (string, error)
+	Set(account, password string) error
+	Delete(account string) error
+}
+
+// passwordKeyringStore is the keyring saved passwords go to: the Secret
+// Service on Linux, the Keychain on macOS and the Credential Manager on
+// Windows. FILE_SCANNER_KEYRING=memory replaces it with one that only lives
+// as long as the process, for machines without a keyring service and for
+// trying things out without touching the real one.
+var passwordKeyringStore = newSecretStore(os.Getenv("FILE_SCANNER_KEYRING"))
+
+func newSecretStore(kind string) secretStore {
+	if kind == "memory" {
+		return &memoryKeyring{passwords: make(map[string]string)}
+	}
+	return osKeyring{}
+}
+
+type osKeyring struct{}
+
+func (osKeyring) Get(account string) (string, error) {
+	password, err := keyring.Get(keyringService, account)
+	if err != nil {
+		return "", fmt.Errorf("error reading password from keyring: %v", err)
+	}
+	return password, nil
+}
+
+func (osKeyring) Set(account, password string) error {
+	if err := keyring.Set(keyringService, account, password); err != nil {
+		return fmt.Errorf("error saving password to keyring: %v", err)
+	}
+	return nil
+}
+
+// Delete removes the password, if there is one.
+func (osKeyring) Delete(account string) error {
+	if err := keyring.Delete(keyringService, account); err != nil && err != keyring.ErrNotFound {
+		return fmt.Errorf("error removing password from keyring: %v", err)
+	}
+	return nil
+}
+
+// memoryKeyring is a keyring held in memory.
+type memoryKeyring struct {
+	mu        sync.Mutex
+	passwords map[string]string
+}
+
+func (m *memoryKeyring) Get(account string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	password, ok := m.passwords[account]
+	if !ok {
+		return "", fmt.Errorf("error reading password from keyring: %v", keyring.ErrNotFound)
+	}
+	return password, nil
+}
+
+func (m *memoryKeyring) Set(account, password string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.passwords[account] = password
+	return nil
+}
+
+func (m *memoryKeyring) Delete(account string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.passwords, account)
+	return nil
+}
+
+// Argon2id parameters of the key a master password is stretched into.
+const (
+	vaultTime    = 1
+	vaultMemory  = 64 * 1024
+	vaultThreads = 4
+	vaultKeyLen  = 32
+	vaultSaltLen = 16
+)
+
+func vaultCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key := argon2.IDKey([]byte(passphrase), salt, vaultTime, vaultMemory, vaultThreads, vaultKeyLen)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealPassword encrypts password with AES-256-GCM under a key derived from
+// passphrase and a new salt. Both results are base64: the salt, and the
+// nonce followed by the ciphertext.
+func sealPassword(password, passphrase string) (salt, sealed string, err error) {
+	saltBytes := make([]byte, vaultSaltLen)
+	if _, err := rand.Read(saltBytes); err != nil {
+		return "", "", fmt.Errorf("error encrypting password: %v", err)
+	}
+	aead, err := vaultCipher(passphrase, saltBytes)
+	if err != nil {
+		return "", "", fmt.Errorf("error encrypting password: %v", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", fmt.Errorf("error encrypting password: %v", err)
+	}
+	ciphertext := aead.Seal(nonce, nonce, []byte(password), nil)
+	return base64.StdEncoding.EncodeToString(saltBytes), base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// openPassword decrypts what sealPassword returned. A wrong passphrase
+// fails authentication and returns errWrongMasterPassword.
+func openPassword(salt, sealed, passphrase string) (string, error) {
+	saltBytes, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil {
+		return "", fmt.Errorf("error decoding saved password: %v", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", fmt.Errorf("error decoding saved password: %v", err)
+	}
+	aead, err := vaultCipher(passphrase, saltBytes)
+	if err != nil {
+		return "", fmt.Errorf("error decrypting password: %v", err)
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return "", fmt.Errorf("error decoding saved password: too short")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	password, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errWrongMasterPassword
+	}
+	return string(password), nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useTestAppData points the app data directory at a temporary one.
+func useTestAppData(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	return filepath.Join(home, ".file_scanner")
+}
+
+// useTestKeyring replaces the keyring for the rest of the test.
+func useTestKeyring(t *testing.T, store secretStore) {
+	t.Helper()
+	saved := passwordKeyringStore
+	passwordKeyringStore = store
+	t.Cleanup(func() { passwordKeyringStore = saved })
+}
+
+// unavailableKeyring fails like a machine without a keyring service.
+type unavailableKeyring struct{}
+
+func (unavailableKeyring) Get(string) (string, error) {
+	return "", fmt.Errorf("error reading password from keyring: no keyring service")
+}
+
+func (unavailableKeyring) Set(string, string) error {
+	return fmt.Errorf("error saving password to keyring: no keyring service")
+}
+
+func (unavailableKeyring) Delete(string) error {
+	return fmt.Errorf("error removing password from keyring: no keyring service")
+}
+
+func TestSealOpenPassword(t *testing.T) {
+	salt, sealed, err := sealPassword("s3cret;pw", "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, "s3cret") {
+		t.Fatalf("sealed password %q holds the password", sealed)
+	}
+	password, err := openPassword(salt, sealed, "master")
+	if err != nil || password != "s3cret;pw" {
+		t.Fatalf("openPassword = %q, %v, want s3cret;pw", password, err)
+	}
+
+	otherSalt, otherSealed, err := sealPassword("s3cret;pw", "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherSalt == salt || otherSealed == sealed {
+		t.Errorf("sealing the same password twice gave the same salt or ciphertext")
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext[len(ciphertext)-1] ^= 1
+	tampered := base64.StdEncoding.EncodeToString(ciphertext)
+	tests := []struct {
+		name                     string
+		salt, sealed, passphrase string
+		wrongPassword            bool
+	}{
+		{"wrong master password", salt, sealed, "Master", true},
+		{"empty master password", salt, sealed, "", true},
+		{"other salt", otherSalt, sealed, "master", true},
+		{"tampered ciphertext", salt, tampered, "master", true},
+		{"salt not base64", "%%%", sealed, "master", false},
+		{"ciphertext not base64", salt, "%%%", "master", false},
+		{"ciphertext too short", salt, "AAAA", "master", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			password, err := openPassword(test.salt, test.sealed, test.passphrase)
+			if err == nil {
+				t.Fatalf("openPassword returned %q, want an error", password)
+			}
+			if errors.Is(err, errWrongMasterPassword) != test.wrongPassword {
+				t.Errorf("openPassword error %v, errWrongMasterPassword %t, want %t", err, errors.Is(err, errWrongMasterPassword), test.wrongPassword)
+			}
+		})
+	}
+}
+
+func TestLoadCredentialsMigratesPlaintextPassword(t *testing.T) {
+	tests := []struct {
+		name       string
+		keyring    secretStore
+		passphrase string
+		wantStore  string
+	}{
+		{"to the keyring", &memoryKeyring{passwords: make(map[string]string)}, "", passwordKeyring},
+		{"to the keyring with a master password", &memoryKeyring{passwords: make(map[string]string)}, "master", passwordKeyring},
+		{"to the vault without a keyring", unavailableKeyring{}, "master", passwordVault},
+		{"dropped without a keyring or master password", unavailableKeyring{}, "", passwordNone},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			appData := useTestAppData(t)
+			useTestKeyring(t, test.keyring)
+			legacy := profileFile{
+				Current: "work",
+				Profiles: map[string]map[string]string{
+					"work": {"backend": "mssql", "ip": "db.example.com", "username": "scanner", "password": "plain;secret"},
+				},
+			}
+			if err := writeProfiles(legacy); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, passwordStore, err := loadCredentials("work", test.passphrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if passwordStore != test.wantStore {
+				t.Errorf("password store %q, want %q", passwordStore, test.wantStore)
+			}
+			if cfg.Password != "plain;secret" || cfg.Server != "db.example.com" || cfg.Username != "scanner" {
+				t.Errorf("loaded %+v, want the saved settings and password", cfg)
+			}
+
+			data, err := os.ReadFile(filepath.Join(appData, "profiles.gob"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(data), "plain;secret") {
+				t.Fatalf("profiles.gob still holds the password in plain text")
+			}
+
+			// Loading again finds the password where it was moved to.
+			cfg, passwordStore, err = loadCredentials("work", test.passphrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantPassword := "plain;secret"
+			if test.wantStore == passwordNone {
+				wantPassword = ""
+			}
+			if passwordStore != test.wantStore || cfg.Password != wantPassword {
+				t.Errorf("reloaded password %q from %q, want %q from %q", cfg.Password, passwordStore, wantPassword, test.wantStore)
+			}
+		})
+	}
+}
+
+func TestLoadCredentialsVault(t *testing.T) {
+	useTestAppData(t)
+	useTestKeyring(t, &memoryKeyring{passwords: make(map[string]string)})
+	cfg := ConnectionConfig{Backend: "postgres", Server: "db", Username: "scanner", Password: "pw", Database: "inventory"}
+	if err := saveCredentials("vaulted", cfg, passwordVault, "master"); err != nil {
+		t.Fatal(err)
+	}
+
+	locked, passwordStore, err := loadCredentials("vaulted", "")
+	if err != nil || passwordStore != passwordVault || locked.Password != "" || locked.Server != "db" {
+		t.Errorf("without the master password loaded %+v from %q, %v; want the settings without the password", locked, passwordStore, err)
+	}
+	if _, _, err := loadCredentials("vaulted", "wrong"); !errors.Is(err, errWrongMasterPassword) {
+		t.Errorf("wrong master password gave %v, want errWrongMasterPassword", err)
+	}
+	unlocked, _, err := loadCredentials("vaulted", "master")
+	if err != nil || unlocked.Password != "pw" {
+		t.Errorf("with the master password loaded %q, %v; want pw", unlocked.Password, err)
+	}
+}
@@ -1,26 +1,449 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/url"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	mssql "github.com/microsoft/go-mssqldb"
+	_ "github.com/microsoft/go-mssqldb/integratedauth/krb5"
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+// ConnectionConfig holds the settings needed to reach the catalog database.
+// Backend selects the Storage implementation and defaults to SQL Server.
+type ConnectionConfig struct {
+	Backend  string
+	Server   string
+	Port     string
+	Username string
+	Password string
+	Database string
+	// The files backend writes to the directory in Database, in FileFormat
+	// ("csv" or "ndjson"), compressed with Compression ("", "gzip" or
+	// "zstd"), starting a new file after RotateSize bytes (0 for never).
+	FileFormat  string
+	Compression string
+	RotateSize  int64
+	// Auth is how SQL Server logins are made, one of the auth constants;
+	// empty is a SQL login. Kerberos logs in the principal in Username with
+	// the Keytab file, or with Password when there is none, reading the
+	// Krb5Config file (default KRB5_CONFIG or /etc/krb5.conf) and using its
+	// default realm unless Realm is set. An Azure AD service principal is
+	// the application with client ID Username in directory TenantID, with
+	// Password as its secret. A managed identity is the user-assigned one
+	// with client ID Username, or the host's own when Username is empty.
+	Auth       string
+	Realm      string
+	Krb5Config string
+	Keytab     string
+	TenantID   string
+	// Encrypt is the SQL Server encryption mode, one of the encrypt
+	// constants. Unless TrustServerCert is set, encrypted connections check
+	// the server certificate against the system CAs, or the CA bundle file
+	// in TLSCA, and its host name against the server's, or TLSHostname.
+	// TLSPin lists SHA-256 fingerprints of the certificates to accept, on
+	// top of that check or, with TrustServerCert, instead of it.
+	Encrypt         string
+	TrustServerCert bool
+	TLSCA           string
+	TLSHostname     string
+	TLSPin          string
+	// SSLMode is how PostgreSQL connections use TLS, one of the sslmode
+	// constants; empty is sslRequire, the driver's default.
+	SSLMode string
+}
+
+// SQL Server login modes.
+const (
+	authSQL            = "sql"           // SQL Server login with user name and password
+	authIntegrated     = "integrated"    // the current user: Windows SSPI, or the Kerberos ticket cache elsewhere
+	authKerberos       = "kerberos"      // a Kerberos principal with a keytab or password
+	authAzurePrincipal = "azure-sp"      // an Azure AD service principal with a client secret
+	authAzureMSI       = "azure-msi"     // the Azure managed identity of the host
+	authAzureDefault   = "azure-default" // Azure AD credentials from the environment, workload identity or the Azure CLI
 )
 
-type FileInfo struct {
-	FileName      string
-	FilePath      string
-	PathHash      string
-	FileSize      int64
-	ModTime       time.Time
-	OtherMetadata string
-	Extension     string
+var authModes = []string{authSQL, authIntegrated, authKerberos, authAzurePrincipal, authAzureMSI, authAzureDefault}
+
+// authUsesUsername reports whether logins of mode need a user name.
+func authUsesUsername(mode string) bool {
+	return mode != authIntegrated && mode != authAzureDefault
+}
+
+// authUsesPassword reports whether logins of mode need a password or
+// secret. Kerberos only needs one without a keytab.
+func authUsesPassword(mode string) bool {
+	switch mode {
+	case "", authSQL, authKerberos, authAzurePrincipal:
+		return true
+	}
+	return false
 }
 
-func createTable(db *sql.DB, tableName string) error {
+// mssqlConnString returns the sqlserver:// URL that reaches SQL Server
+// with the login and encryption settings of cfg. It is built with net/url
+// so that passwords and paths holding ; or other special characters are
+// escaped rather than read as further settings. Azure AD logins only take
+// the server from it; mssqlConnector fetches their tokens.
+func mssqlConnString(cfg ConnectionConfig) (string, error) {
+	port := cfg.Port
+	if port == "" {
+		port = "1433"
+	}
+	host, instance, _ := strings.Cut(cfg.Server, `\`)
+	connURL := url.URL{
+		Scheme: "sqlserver",
+		Host:   net.JoinHostPort(host, port),
+	}
+	if instance != "" {
+		connURL.Path = "/" + instance
+	}
+	query := url.Values{}
+	query.Set("database", cfg.Database)
+
+	switch cfg.Auth {
+	case "", authSQL:
+		connURL.User = url.UserPassword(cfg.Username, cfg.Password)
+	case authIntegrated:
+		// Without a user id the driver logs in as the current Windows user.
+		if runtime.GOOS != "windows" {
+			query.Set("authenticator", "krb5")
+		}
+	case authKerberos:
+		if cfg.Username == "" {
+			return "", fmt.Errorf("Kerberos login needs a principal as the user name")
+		}
+		query.Set("authenticator", "krb5")
+		if cfg.Keytab != "" {
+			connURL.User = url.User(cfg.Username)
+			query.Set("krb5-keytabfile", cfg.Keytab)
+		} else {
+			connURL.User = url.UserPassword(cfg.Username, cfg.Password)
+		}
+		if cfg.Krb5Config != "" {
+			query.Set("krb5-configfile", cfg.Krb5Config)
+		}
+		if cfg.Realm != "" {
+			query.Set("krb5-realm", cfg.Realm)
+		}
+	case authAzurePrincipal:
+		if cfg.Username == "" || cfg.Password == "" {
+			return "", fmt.Errorf("service principal login needs a client ID as the user name and a client secret as the password")
+		}
+	case authAzureMSI, authAzureDefault:
+	default:
+		return "", fmt.Errorf("unknown login mode %q; use one of %s", cfg.Auth, strings.Join(authModes, ", "))
+	}
+
+	if err := mssqlTLSParams(cfg, query); err != nil {
+		return "", err
+	}
+	connURL.RawQuery = query.Encode()
+	return connURL.String(), nil
+}
+
+// mssqlConnector returns the connector that opens connections to SQL Server
+// as cfg asks, checking the server certificate against cfg.TLSPin.
+func mssqlConnector(cfg ConnectionConfig) (driver.Connector, error) {
+	connString, err := mssqlConnString(cfg)
+	if err != nil {
+		return nil, err
+	}
+	config, err := msdsn.Parse(connString)
+	if err != nil {
+		// A URL error quotes the whole URL, password included.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("error in connection settings: %v", err)
+	}
+	if cfg.TLSPin != "" {
+		pins, err := parseCertificatePins(cfg.TLSPin)
+		if err != nil {
+			return nil, err
+		}
+		if config.TLSConfig == nil {
+			return nil, fmt.Errorf("certificate pinning needs encryption")
+		}
+		config.TLSConfig.VerifyConnection = verifyCertificatePins(pins)
+	}
+
+	switch cfg.Auth {
+	case authAzurePrincipal, authAzureMSI, authAzureDefault:
+		tokenProvider, err := azureTokenProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		var workflow byte = mssql.FedAuthADALWorkflowPassword
+		if cfg.Auth == authAzureMSI {
+			workflow = mssql.FedAuthADALWorkflowMSI
+		}
+		return mssql.NewActiveDirectoryTokenConnector(config, workflow, tokenProvider)
+	}
+	return mssql.NewConnectorConfig(config), nil
+}
+
+// azureTokenProvider returns the callback that fetches an Azure AD access
+// token whenever the server asks for one at login. The server names the
+// token's scope and, unless cfg.TenantID overrides it, the service
+// principal's tenant. The credential is made once, or once the tenant is
+// known, and shared by every connection of the pool, so the tokens it
+// caches are reused until they expire.
+func azureTokenProvider(cfg ConnectionConfig) (func(ctx context.Context, serverSPN, stsURL string) (string, error), error) {
+	newCredential := func(tenantID string) (azcore.TokenCredential, error) {
+		var credential azcore.TokenCredential
+		var err error
+		switch cfg.Auth {
+		case authAzurePrincipal:
+			credential, err = azidentity.NewClientSecretCredential(tenantID, cfg.Username, cfg.Password, nil)
+		case authAzureMSI:
+			var options *azidentity.ManagedIdentityCredentialOptions
+			if cfg.Username != "" {
+				options = &azidentity.ManagedIdentityCredentialOptions{ID: azidentity.ClientID(cfg.Username)}
+			}
+			credential, err = azidentity.NewManagedIdentityCredential(options)
+		default:
+			credential, err = azidentity.NewDefaultAzureCredential(nil)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error setting up Azure AD login: %v", err)
+		}
+		return credential, nil
+	}
+
+	var mu sync.Mutex
+	var credential azcore.TokenCredential
+	var credentialTenant string
+	if cfg.Auth != authAzurePrincipal || cfg.TenantID != "" {
+		var err error
+		if credential, err = newCredential(cfg.TenantID); err != nil {
+			return nil, err
+		}
+		credentialTenant = cfg.TenantID
+	}
+
+	return func(ctx context.Context, serverSPN, stsURL string) (string, error) {
+		tenantID := cfg.TenantID
+		if tenantID == "" && cfg.Auth == authAzurePrincipal {
+			tenantID = stsURL[strings.LastIndex(stsURL, "/")+1:]
+		}
+		mu.Lock()
+		if credential == nil || tenantID != credentialTenant {
+			newOne, err := newCredential(tenantID)
+			if err != nil {
+				mu.Unlock()
+				return "", err
+			}
+			credential, credentialTenant = newOne, tenantID
+		}
+		current := credential
+		mu.Unlock()
+
+		scope := strings.TrimSuffix(serverSPN, "/.default") + "/.default"
+		token, err := current.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{scope}})
+		if err != nil {
+			return "", fmt.Errorf("error getting Azure AD token: %v", err)
+		}
+		return token.Token, nil
+	}, nil
+}
+
+func openDatabase(cfg ConnectionConfig) (*sql.DB, error) {
+	port := cfg.Port
+	if port == "" {
+		port = "1433"
+	}
+
+	connector, err := mssqlConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(connector)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		if isCertificateError(err) {
+			return nil, fmt.Errorf("server certificate of %s failed validation: %v; check the CA bundle, the host name in the certificate and the pinned fingerprints, or trust the server certificate", cfg.Server, err)
+		}
+		return nil, fmt.Errorf("error pinging database: %v", err)
+	}
+
+	log.Printf("Connected to database '%s' on %s:%s", cfg.Database, cfg.Server, port)
+	return db, nil
+}
+
+// mssqlStorage is the SQL Server implementation of Storage. Catalogs are
+// tables in the connected database.
+type mssqlStorage struct {
+	db *sql.DB
+}
+
+func openMSSQLStorage(cfg ConnectionConfig) (Storage, error) {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &mssqlStorage{db: db}, nil
+}
+
+// mssqlTable validates a catalog name and quotes it for T-SQL.
+func mssqlTable(name string) (string, error) {
+	table, err := parseCatalogTable(name, maxIdentifierLength)
+	if err != nil {
+		return "", err
+	}
+	return table.quoted(bracketQuote), nil
+}
+
+func (s *mssqlStorage) CreateCatalog(name string) error {
+	table, err := parseCatalogTable(name, maxIdentifierLength)
+	if err != nil {
+		return err
+	}
+	return createTable(s.db, table)
+}
+
+func (s *mssqlStorage) ListCatalogs() ([]string, error) {
+	return getTables(s.db)
+}
+
+func (s *mssqlStorage) LookupFiles(name string, pathHashes []string) (map[string]FileState, error) {
+	table, err := mssqlTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return queryFileStates(s.db, table, pathHashes, func(i int) string { return fmt.Sprintf("@p%d", i) })
+}
+
+func (s *mssqlStorage) TouchFiles(name string, pathHashes []string, seenAt time.Time) error {
+	table, err := mssqlTable(name)
+	if err != nil {
+		return err
+	}
+	return touchFileRows(s.db, table, pathHashes, seenAt, func(i int) string { return fmt.Sprintf("@p%d", i) })
+}
+
+func (s *mssqlStorage) MarkUnseen(name, rootPath string, seenAt time.Time, purge bool) (DeletionSummary, error) {
+	table, err := mssqlTable(name)
+	if err != nil {
+		return DeletionSummary{}, err
+	}
+	return markUnseenRows(s.db, table, rootPath, seenAt, purge, func(i int) string { return fmt.Sprintf("@p%d", i) })
+}
+
+func (s *mssqlStorage) MarkDeleted(name string, paths []string, purge bool) (DeletionSummary, error) {
+	table, err := mssqlTable(name)
+	if err != nil {
+		return DeletionSummary{}, err
+	}
+	return markDeletedRows(s.db, table, paths, purge, func(i int) string { return fmt.Sprintf("@p%d", i) })
+}
+
+func (s *mssqlStorage) ListChildren(name, path string) ([]FileInfo, error) {
+	table, err := mssqlTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return listChildren(s.db, table, path, func(i int) string { return fmt.Sprintf("@p%d", i) })
+}
+
+func (s *mssqlStorage) SubtreeTotals(name, path string) (int64, int64, error) {
+	table, err := mssqlTable(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	return subtreeTotals(s.db, table, path, "WITH", " OPTION (MAXRECURSION 0)", func(i int) string { return fmt.Sprintf("@p%d", i) })
+}
+
+// mssqlOwner reads the owner name from other_metadata, falling back to the
+// numeric uid. Rows written before metadata was JSON hold an empty string.
+const mssqlOwner = `CASE WHEN ISJSON(other_metadata) = 1
+	THEN COALESCE(JSON_VALUE(other_metadata, '$.owner'), JSON_VALUE(other_metadata, '$.uid')) END`
+
+func (s *mssqlStorage) UsageBreakdown(name, path, by string) ([]UsageGroup, error) {
+	table, err := mssqlTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return usageBreakdown(s.db, table, path, by, mssqlOwner, func(i int) string { return fmt.Sprintf("@p%d", i) })
+}
+
+func (s *mssqlStorage) SearchFiles(name string, query FileQuery) ([]FileInfo, int64, error) {
+	table, err := mssqlTable(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	return searchFiles(s.db, table, query, offsetFetch, func(i int) string { return fmt.Sprintf("@p%d", i) })
+}
+
+func (s *mssqlStorage) StreamFiles(name, root string, fn func(FileInfo) error) error {
+	table, err := mssqlTable(name)
+	if err != nil {
+		return err
+	}
+	return streamFiles(s.db, table, root, fn, func(i int) string { return fmt.Sprintf("@p%d", i) })
+}
+
+func (s *mssqlStorage) SizeCollisions(name string) ([]FileInfo, error) {
+	table, err := mssqlTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return querySizeCollisions(s.db, table)
+}
+
+func (s *mssqlStorage) UpsertBatch(name string, files []FileInfo) error {
+	table, err := mssqlTable(name)
+	if err != nil {
+		return err
+	}
+	return batchInsert(s.db, table, files)
+}
+
+// Finalize has nothing to do for SQL Server; every batch is committed as it
+// is merged.
+func (s *mssqlStorage) Finalize(name string) error {
+	return nil
+}
+
+func (s *mssqlStorage) Close() error {
+	return s.db.Close()
+}
+
+// mssqlAddedColumns are added to tables created before they existed.
+var mssqlAddedColumns = []addedColumn{
+	{"content_hash", "VARCHAR(80) NULL"},
+	{"last_seen", "DATETIME2(3) NULL"},
+	{"deleted_at", "DATETIME2(3) NULL"},
+	{"mime_type", "VARCHAR(100) NULL"},
+	{"mime_mismatch", "BIT NOT NULL DEFAULT 0"},
+	{"parent_path_hash", "VARCHAR(64) NULL"},
+	{"is_dir", "BIT NOT NULL DEFAULT 0"},
+	{"file_count", "BIGINT NOT NULL DEFAULT 0"},
+	{"depth", "INT NULL"},
+}
+
+// createTable creates the table if it does not exist yet and adds the
+// columns and index of later versions to one that does. The quoted name is
+// passed to OBJECT_ID and COL_LENGTH as a parameter.
+func createTable(db *sql.DB, table catalogTable) error {
+	tableName := table.quoted(bracketQuote)
 	query := fmt.Sprintf(`
-	IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='%s' and xtype='U')
+	IF OBJECT_ID(@p1, 'U') IS NULL
 	CREATE TABLE %s (
 		Id INT PRIMARY KEY IDENTITY(1,1),
 		file_name NVARCHAR(255) NOT NULL,
@@ -29,20 +452,47 @@ func createTable(db *sql.DB, tableName string) error {
 		file_size BIGINT NOT NULL,
 		mod_time DATETIME2(7) NOT NULL,
 		other_metadata NVARCHAR(MAX) NULL,
-		extension NVARCHAR(50) NULL
-	)`, tableName, tableName)
+		extension NVARCHAR(50) NULL,
+		content_hash VARCHAR(80) NULL,
+		last_seen DATETIME2(3) NULL,
+		deleted_at DATETIME2(3) NULL,
+		mime_type VARCHAR(100) NULL,
+		mime_mismatch BIT NOT NULL DEFAULT 0,
+		parent_path_hash VARCHAR(64) NULL,
+		is_dir BIT NOT NULL DEFAULT 0,
+		file_count BIGINT NOT NULL DEFAULT 0,
+		depth INT NULL
+	)`, tableName)
 
-	_, err := db.Exec(query)
+	_, err := db.Exec(query, tableName)
 	if err != nil {
 		return fmt.Errorf("error creating table: %v", err)
 	}
 
+	for _, column := range mssqlAddedColumns {
+		query := fmt.Sprintf("IF COL_LENGTH(@p1, @p2) IS NULL ALTER TABLE %s ADD %s %s",
+			tableName, column.name, column.definition)
+		if _, err := db.Exec(query, tableName, column.name); err != nil {
+			return fmt.Errorf("error adding column %s: %v", column.name, err)
+		}
+	}
+
+	// The index serves ListChildren and the joins of SubtreeTotals.
+	query = fmt.Sprintf(`IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = @p1 AND object_id = OBJECT_ID(@p2))
+	CREATE INDEX %s ON %s (parent_path_hash)`, bracketQuote(table.parentIndex()), tableName)
+	if _, err := db.Exec(query, table.parentIndex(), tableName); err != nil {
+		return fmt.Errorf("error creating parent index: %v", err)
+	}
+
 	log.Printf("Table '%s' created or already exists", tableName)
 	return nil
 }
 
+// getTables lists the tables of the database, qualified with their schema
+// unless it is the user's default one.
 func getTables(db *sql.DB) ([]string, error) {
-	query := `SELECT TABLE_NAME 
+	query := `SELECT CASE WHEN TABLE_SCHEMA = SCHEMA_NAME() THEN TABLE_NAME
+				ELSE TABLE_SCHEMA + '.' + TABLE_NAME END
 			  FROM INFORMATION_SCHEMA.TABLES 
 			  WHERE TABLE_TYPE = 'BASE TABLE' AND TABLE_CATALOG = DB_NAME()`
 
@@ -75,34 +525,34 @@ func batchInsert(db *sql.DB, tableName string, files []FileInfo) error {
 
 	// Prepare the values and parameters
 	valueStrings := make([]string, 0, len(files))
-	valueArgs := make([]interface{}, 0, len(files)*7)
-	for i, file := range files {
-		valueStrings = append(valueStrings, fmt.Sprintf("(@p%d, @p%d, @p%d, @p%d, @p%d, @p%d, @p%d)",
-			i*7+1, i*7+2, i*7+3, i*7+4, i*7+5, i*7+6, i*7+7))
-		valueArgs = append(valueArgs, sql.Named(fmt.Sprintf("p%d", i*7+1), file.FileName))
-		valueArgs = append(valueArgs, sql.Named(fmt.Sprintf("p%d", i*7+2), file.FilePath))
-		valueArgs = append(valueArgs, sql.Named(fmt.Sprintf("p%d", i*7+3), file.PathHash))
-		valueArgs = append(valueArgs, sql.Named(fmt.Sprintf("p%d", i*7+4), file.FileSize))
-		valueArgs = append(valueArgs, sql.Named(fmt.Sprintf("p%d", i*7+5), file.ModTime))
-		valueArgs = append(valueArgs, sql.Named(fmt.Sprintf("p%d", i*7+6), file.OtherMetadata))
-		valueArgs = append(valueArgs, sql.Named(fmt.Sprintf("p%d", i*7+7), file.Extension))
+	valueArgs := make([]interface{}, 0, len(files)*len(fileColumns))
+	for _, file := range files {
+		values := fileValues(file)
+		placeholders := make([]string, len(values))
+		for j, value := range values {
+			name := fmt.Sprintf("p%d", len(valueArgs)+1)
+			placeholders[j] = "@" + name
+			valueArgs = append(valueArgs, sql.Named(name, value))
+		}
+		valueStrings = append(valueStrings, "("+strings.Join(placeholders, ", ")+")")
+	}
+
+	sourceColumns := make([]string, len(fileColumns))
+	for i, column := range fileColumns {
+		sourceColumns[i] = "source." + column
 	}
+	columns := strings.Join(fileColumns, ", ")
 
 	// Complete the query
 	query += strings.Join(valueStrings, ",")
-	query += `) AS source (file_name, file_path, path_hash, file_size, mod_time, other_metadata, extension)
+	query += fmt.Sprintf(`) AS source (%s)
 	ON target.path_hash = source.path_hash
 	WHEN MATCHED THEN
 		UPDATE SET
-			file_name = source.file_name,
-			file_path = source.file_path,
-			file_size = source.file_size,
-			mod_time = source.mod_time,
-			other_metadata = source.other_metadata,
-			extension = source.extension
+		%s
 	WHEN NOT MATCHED THEN
-		INSERT (file_name, file_path, path_hash, file_size, mod_time, other_metadata, extension)
-		VALUES (source.file_name, source.file_path, source.path_hash, source.file_size, source.mod_time, source.other_metadata, source.extension);`
+		INSERT (%s)
+		VALUES (%s);`, columns, upsertAssignments("source"), columns, strings.Join(sourceColumns, ", "))
 
 	log.Printf("Executing batch merge for %d files", len(files))
 	log.Printf("Query: %s", query)
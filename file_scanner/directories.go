@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pathHash is the catalog key of a file or directory path.
+func pathHash(path string) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(path))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// pathDepth counts the elements of path below its volume root, so "/" is 0
+// and `C:\Users\alice` is 2.
+func pathDepth(path string) int {
+	path = filepath.Clean(path)
+	path = path[len(filepath.VolumeName(path)):]
+	depth := 0
+	for _, element := range strings.Split(path, string(filepath.Separator)) {
+		if element != "" {
+			depth++
+		}
+	}
+	return depth
+}
+
+// parentHash is the path hash of the directory containing path. The row of
+// the scanned root points at a parent that is not in the catalog.
+func parentHash(path string) string {
+	return pathHash(filepath.Dir(path))
+}
+
+// newDirectoryRow describes a directory without its totals.
+func newDirectoryRow(path string, info fs.FileInfo) FileInfo {
+	path = filepath.Clean(path)
+	return FileInfo{
+		FileName:      info.Name(),
+		FilePath:      path,
+		PathHash:      pathHash(path),
+		ParentHash:    parentHash(path),
+		Depth:         pathDepth(path),
+		ModTime:       info.ModTime(),
+		OtherMetadata: encodeMetadata(collectMetadata(path, info, info)),
+		IsDir:         true,
+	}
+}
+
+// dirTotals adds up the files below every directory of a scan. The walker
+// registers each directory it enters before any file in it is queued, and
+// the batch writer adds each file once processed, so a directory's totals
+// cover the files the filter rules kept, at any depth.
+type dirTotals struct {
+	mu   sync.Mutex
+	root string
+	dirs map[string]*FileInfo
+}
+
+func newDirTotals(root string) *dirTotals {
+	return &dirTotals{root: filepath.Clean(root), dirs: make(map[string]*FileInfo)}
+}
+
+func (t *dirTotals) addDir(path string, d fs.DirEntry) {
+	info, err := d.Info()
+	if err != nil {
+		log.Printf("Error getting directory info for %s: %v", path, err)
+		return
+	}
+	row := newDirectoryRow(path, info)
+	t.mu.Lock()
+	t.dirs[row.FilePath] = &row
+	t.mu.Unlock()
+}
+
+func (t *dirTotals) addFile(file FileInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for dir := filepath.Dir(file.FilePath); ; dir = filepath.Dir(dir) {
+		if row, ok := t.dirs[dir]; ok {
+			row.FileCount++
+			row.FileSize += file.FileSize
+		}
+		if dir == t.root || dir == filepath.Dir(dir) {
+			return
+		}
+	}
+}
+
+// rows returns the directory rows, parents first.
+func (t *dirTotals) rows() []FileInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rows := make([]FileInfo, 0, len(t.dirs))
+	for _, row := range t.dirs {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].FilePath < rows[j].FilePath })
+	return rows
+}
+
+// writeDirectories upserts directory rows in batches of size. They bypass
+// the incremental comparison, which only looks at size and modification
+// time, and are not counted as written files.
+func writeDirectories(store Storage, tableName string, rows []FileInfo, size int, seenAt time.Time) error {
+	for start := 0; start < len(rows); start += size {
+		end := start + size
+		if end > len(rows) {
+			end = len(rows)
+		}
+		batch := rows[start:end]
+		for i := range batch {
+			batch[i].LastSeen = seenAt
+		}
+		if err := store.UpsertBatch(tableName, batch); err != nil {
+			return fmt.Errorf("error writing directories: %v", err)
+		}
+	}
+	return nil
+}
+
+// refreshDirectories rewrites the rows of the given directories, and of
+// every directory between them and root, with totals read back from the
+// catalog. Watch mode calls it after applying a round of changes. The
+// totals are found through the directory rows below, so directories are
+// written deepest first and one created since the last round is in the
+// catalog before the directories above it are totalled.
+func refreshDirectories(writer *batchWriter, reader CatalogReader, root string, dirs []string) error {
+	top := filepath.Clean(root)
+	affected := make(map[string]bool)
+	for _, dir := range dirs {
+		for dir = filepath.Clean(dir); !affected[dir] && withinRoot(top, dir); dir = filepath.Dir(dir) {
+			affected[dir] = true
+			if dir == top {
+				break
+			}
+		}
+	}
+
+	filters := writer.opts.Filters
+	rows := make([]FileInfo, 0, len(affected))
+	for dir := range affected {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			continue // removed directories were marked deleted already
+		}
+		if dir != top && (filters.pruneDir(root, dir) || filters.prunedPath(root, dir)) {
+			continue
+		}
+		rows = append(rows, newDirectoryRow(dir, info))
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Depth > rows[j].Depth })
+
+	for start := 0; start < len(rows); {
+		end := start + 1
+		for end < len(rows) && rows[end].Depth == rows[start].Depth {
+			end++
+		}
+		level := rows[start:end]
+		for i := range level {
+			var err error
+			level[i].FileCount, level[i].FileSize, err = reader.SubtreeTotals(writer.tableName, level[i].FilePath)
+			if err != nil {
+				return err
+			}
+		}
+		if err := writeDirectories(writer.store, writer.tableName, level, writer.size, writer.seenAt); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// withinRoot reports whether path is root or below it. Both must be clean.
+func withinRoot(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
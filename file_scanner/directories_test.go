@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openTestCatalog opens a SQLite store in a temporary directory with an
+// empty "files" catalog.
+func openTestCatalog(t *testing.T) Storage {
+	t.Helper()
+	store, err := openSQLiteStorage(ConnectionConfig{Backend: "sqlite", Database: filepath.Join(t.TempDir(), "catalog.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := store.CreateCatalog("files"); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func writeTestFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// directoryRow returns the catalog row of the directory at path.
+func directoryRow(t *testing.T, reader CatalogReader, path string) FileInfo {
+	t.Helper()
+	children, err := reader.ListChildren("files", filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, child := range children {
+		if child.FilePath == path {
+			if !child.IsDir {
+				t.Fatalf("%s is not a directory row", path)
+			}
+			return child
+		}
+	}
+	t.Fatalf("no row for %s", path)
+	return FileInfo{}
+}
+
+func TestRefreshDirectoriesNewNestedDirectory(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+	writeTestFile(t, filepath.Join(root, "a.bin"), 8)
+	writeTestFile(t, filepath.Join(root, "b.bin"), 8)
+	writeTestFile(t, filepath.Join(root, "sub", "c.bin"), 8)
+	writeTestFile(t, filepath.Join(root, "sub", "d.bin"), 8)
+
+	ctx := context.Background()
+	store := openTestCatalog(t)
+	scanStateLock.Lock()
+	scanState.FilesScanned = make(map[string]bool)
+	scanStateLock.Unlock()
+	if err := scanFolder(ctx, store, "files", root, ScanOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	reader := store.(CatalogReader)
+	if row := directoryRow(t, reader, root); row.FileCount != 4 || row.FileSize != 32 {
+		t.Fatalf("after the scan the root has %d files of %d bytes, want 4 of 32", row.FileCount, row.FileSize)
+	}
+
+	// A directory tree created while watching: only the new file is
+	// reported, and none of the directories above it has a row yet.
+	added := filepath.Join(root, "newdir", "deep", "x.bin")
+	writeTestFile(t, added, 2)
+	writer := newBatchWriter(store, "files", ScanOptions{}, newRateLimiter(0))
+	if err := applyWatchEvents(ctx, writer, store.(ChangeTracker), reader, root, []string{added}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path         string
+		files, bytes int64
+	}{
+		{filepath.Join(root, "newdir", "deep"), 1, 2},
+		{filepath.Join(root, "newdir"), 1, 2},
+		{filepath.Join(root, "sub"), 2, 16},
+		{root, 5, 34},
+	}
+	for _, test := range tests {
+		row := directoryRow(t, reader, test.path)
+		if row.FileCount != test.files || row.FileSize != test.bytes {
+			t.Errorf("%s has %d files of %d bytes, want %d of %d", test.path, row.FileCount, row.FileSize, test.files, test.bytes)
+		}
+	}
+}
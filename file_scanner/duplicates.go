@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DuplicateGroup is a set of files with identical content. WastedBytes is
+// the space that would be freed by keeping only one copy.
+type DuplicateGroup struct {
+	ContentHash string   `json:"content_hash"`
+	FileSize    int64    `json:"file_size"`
+	WastedBytes int64    `json:"wasted_bytes"`
+	Paths       []string `json:"paths"`
+}
+
+// defaultDuplicateHash is used when no algorithm is chosen for a report.
+const defaultDuplicateHash = hashSHA256
+
+// findDuplicates groups the files of a catalog by size and then by content
+// hash. Size is the pre-filter: only files sharing a size with another file
+// are candidates, and only candidates without a stored hash of the chosen
+// algorithm are read and hashed. Groups are ordered by wasted bytes.
+func findDuplicates(ctx context.Context, reader CatalogReader, tableName, algorithm string, limiter *rateLimiter) ([]DuplicateGroup, error) {
+	if algorithm == hashNone {
+		algorithm = defaultDuplicateHash
+	}
+	if err := validateHashAlgorithm(algorithm); err != nil {
+		return nil, err
+	}
+
+	candidates, err := reader.SizeCollisions(tableName)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Found %d files sharing a size with another file in '%s'", len(candidates), tableName)
+
+	prefix := algorithm + ":"
+	var toHash []int
+	for i, file := range candidates {
+		if !strings.HasPrefix(file.ContentHash, prefix) {
+			toHash = append(toHash, i)
+		}
+	}
+	if len(toHash) > 0 {
+		log.Printf("Hashing %d candidate files with %s", len(toHash), algorithm)
+		if err := hashCandidates(ctx, candidates, toHash, algorithm, limiter); err != nil {
+			return nil, err
+		}
+	}
+
+	bySize := make(map[int64][]FileInfo)
+	for _, file := range candidates {
+		if strings.HasPrefix(file.ContentHash, prefix) {
+			bySize[file.FileSize] = append(bySize[file.FileSize], file)
+		}
+	}
+
+	var groups []DuplicateGroup
+	for size, files := range bySize {
+		byHash := make(map[string][]string)
+		for _, file := range files {
+			byHash[file.ContentHash] = append(byHash[file.ContentHash], file.FilePath)
+		}
+		for contentHash, paths := range byHash {
+			if len(paths) < 2 {
+				continue
+			}
+			sort.Strings(paths)
+			groups = append(groups, DuplicateGroup{
+				ContentHash: contentHash,
+				FileSize:    size,
+				WastedBytes: size * int64(len(paths)-1),
+				Paths:       paths,
+			})
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].WastedBytes != groups[j].WastedBytes {
+			return groups[i].WastedBytes > groups[j].WastedBytes
+		}
+		return groups[i].ContentHash < groups[j].ContentHash
+	})
+	return groups, nil
+}
+
+// hashCandidates fills in ContentHash for the files at the given indexes
+// using the scan worker count. Files that can no longer be read are logged
+// and left out of the report.
+func hashCandidates(ctx context.Context, files []FileInfo, indexes []int, algorithm string, limiter *rateLimiter) error {
+	return forEachIndex(ctx, indexes, func(index int) {
+		contentHash, err := hashFileContent(ctx, files[index].FilePath, algorithm, limiter)
+		if err != nil {
+			log.Printf("Error hashing %s: %v", files[index].FilePath, err)
+			files[index].ContentHash = ""
+			return
+		}
+		files[index].ContentHash = contentHash
+	})
+}
+
+// forEachIndex calls fn for each index on the scan worker count of
+// goroutines, stopping early when ctx is cancelled.
+func forEachIndex(ctx context.Context, indexes []int, fn func(index int)) error {
+	indexChan := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexChan {
+				fn(index)
+			}
+		}()
+	}
+
+	for _, index := range indexes {
+		select {
+		case <-ctx.Done():
+			close(indexChan)
+			wg.Wait()
+			return ctx.Err()
+		case indexChan <- index:
+		}
+	}
+	close(indexChan)
+	wg.Wait()
+	return ctx.Err()
+}
+
+// duplicateTotals returns the number of redundant copies and the bytes they
+// take up across all groups.
+func duplicateTotals(groups []DuplicateGroup) (int, int64) {
+	var copies int
+	var wasted int64
+	for _, group := range groups {
+		copies += len(group.Paths) - 1
+		wasted += group.WastedBytes
+	}
+	return copies, wasted
+}
+
+// writeDuplicatesCSV writes one row per file, numbered by group.
+func writeDuplicatesCSV(w io.Writer, groups []DuplicateGroup) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"group", "content_hash", "file_size", "wasted_bytes", "file_path"}); err != nil {
+		return fmt.Errorf("error writing CSV header: %v", err)
+	}
+	for i, group := range groups {
+		for _, path := range group.Paths {
+			record := []string{
+				strconv.Itoa(i + 1),
+				group.ContentHash,
+				strconv.FormatInt(group.FileSize, 10),
+				strconv.FormatInt(group.WastedBytes, 10),
+				path,
+			}
+			if err := writer.Write(record); err != nil {
+				return fmt.Errorf("error writing CSV row: %v", err)
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeDuplicatesJSON(w io.Writer, groups []DuplicateGroup) error {
+	if groups == nil {
+		groups = []DuplicateGroup{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(groups); err != nil {
+		return fmt.Errorf("error writing JSON: %v", err)
+	}
+	return nil
+}
+
+func writeDuplicates(w io.Writer, format string, groups []DuplicateGroup) error {
+	switch format {
+	case "csv":
+		return writeDuplicatesCSV(w, groups)
+	case "json":
+		return writeDuplicatesJSON(w, groups)
+	default:
+		return fmt.Errorf("unknown report format %q", format)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Kinds of exported columns, which decide how each format encodes them.
+const (
+	exportString = iota
+	exportInt32
+	exportInt64
+	exportBool
+	exportTime // optional, the zero time is exported as null
+	exportJSON // a string holding a JSON document
+)
+
+// exportColumn is a column of an exported catalog.
+type exportColumn struct {
+	name  string
+	kind  int
+	value func(file FileInfo) interface{}
+}
+
+// exportColumns are the columns of an export, named after the catalog
+// columns. Times are exported as instants: mod_time is stored as a local
+// wall clock and last_seen as a UTC one, but drivers read both back
+// without a time zone.
+var exportColumns = []exportColumn{
+	{"file_name", exportString, func(f FileInfo) interface{} { return f.FileName }},
+	{"file_path", exportString, func(f FileInfo) interface{} { return f.FilePath }},
+	{"path_hash", exportString, func(f FileInfo) interface{} { return f.PathHash }},
+	{"file_size", exportInt64, func(f FileInfo) interface{} { return f.FileSize }},
+	{"mod_time", exportTime, func(f FileInfo) interface{} { return wallClock(f.ModTime, time.Local) }},
+	{"other_metadata", exportJSON, func(f FileInfo) interface{} { return f.OtherMetadata }},
+	{"extension", exportString, func(f FileInfo) interface{} { return f.Extension }},
+	{"content_hash", exportString, func(f FileInfo) interface{} { return f.ContentHash }},
+	{"last_seen", exportTime, func(f FileInfo) interface{} { return wallClock(f.LastSeen, time.UTC) }},
+	{"mime_type", exportString, func(f FileInfo) interface{} { return f.MIMEType }},
+	{"mime_mismatch", exportBool, func(f FileInfo) interface{} { return f.MIMEMismatch }},
+	{"parent_path_hash", exportString, func(f FileInfo) interface{} { return f.ParentHash }},
+	{"is_dir", exportBool, func(f FileInfo) interface{} { return f.IsDir }},
+	{"file_count", exportInt64, func(f FileInfo) interface{} { return f.FileCount }},
+	{"depth", exportInt32, func(f FileInfo) interface{} { return int32(f.Depth) }},
+}
+
+// wallClock reads the wall clock of t in loc. The zero time stays zero.
+func wallClock(t time.Time, loc *time.Location) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// exportFormats lists the formats exportCatalog can write.
+var exportFormats = []string{"csv", "ndjson", "parquet"}
+
+// rowWriter writes exported rows one at a time. Close flushes what is
+// buffered but does not close the underlying writer.
+type rowWriter interface {
+	Write(file FileInfo) error
+	Close() error
+}
+
+func newRowWriter(w io.Writer, format string) (rowWriter, error) {
+	switch format {
+	case "csv":
+		return newCSVRowWriter(w)
+	case "ndjson":
+		return &ndjsonRowWriter{w: bufio.NewWriter(w)}, nil
+	case "parquet":
+		return newParquetWriter(w, exportColumns), nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// exportCatalog streams the rows of a catalog to w in format and returns how
+// many it wrote. A non-empty root limits the export to rows below it. When
+// filter rules are set, only the files they keep are exported, as if they
+// had been scanned with them; path patterns are relative to root, or to the
+// volume root without one.
+func exportCatalog(ctx context.Context, reader CatalogReader, tableName, root string, rules FilterRules, w io.Writer, format string) (int64, error) {
+	writer, err := newRowWriter(w, format)
+	if err != nil {
+		return 0, err
+	}
+	if root != "" {
+		root = filepath.Clean(root)
+	}
+
+	var rows int64
+	err = reader.StreamFiles(tableName, root, func(file FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if rules.active() && !exportMatches(rules, root, file) {
+			return nil
+		}
+		rows++
+		return writer.Write(file)
+	})
+	if err != nil {
+		return rows, err
+	}
+	if err := writer.Close(); err != nil {
+		return rows, err
+	}
+	return rows, nil
+}
+
+// exportMatches applies filter rules to a catalog row. Directory rows total
+// files the rules might not keep, so they are left out.
+func exportMatches(rules FilterRules, root string, file FileInfo) bool {
+	if file.IsDir {
+		return false
+	}
+	if root == "" {
+		root = filepath.VolumeName(file.FilePath) + string(filepath.Separator)
+	}
+	return !rules.prunedPath(root, file.FilePath) && rules.matchName(root, file.FilePath) &&
+		rules.matchInfo(file.FileSize, wallClock(file.ModTime, time.Local))
+}
+
+// exportText renders a value of kind for CSV. Nulls are empty.
+func exportText(kind int, value interface{}) string {
+	switch kind {
+	case exportInt32:
+		return strconv.FormatInt(int64(value.(int32)), 10)
+	case exportInt64:
+		return strconv.FormatInt(value.(int64), 10)
+	case exportBool:
+		return strconv.FormatBool(value.(bool))
+	case exportTime:
+		if t := value.(time.Time); !t.IsZero() {
+			return t.Format(time.RFC3339Nano)
+		}
+		return ""
+	default:
+		return value.(string)
+	}
+}
+
+type csvRowWriter struct {
+	writer *csv.Writer
+	record []string
+}
+
+func newCSVRowWriter(w io.Writer) (*csvRowWriter, error) {
+	writer := csv.NewWriter(w)
+	header := make([]string, len(exportColumns))
+	for i, column := range exportColumns {
+		header[i] = column.name
+	}
+	if err := writer.Write(header); err != nil {
+		return nil, fmt.Errorf("error writing CSV header: %v", err)
+	}
+	return &csvRowWriter{writer: writer, record: make([]string, len(exportColumns))}, nil
+}
+
+func (c *csvRowWriter) Write(file FileInfo) error {
+	for i, column := range exportColumns {
+		c.record[i] = exportText(column.kind, column.value(file))
+	}
+	if err := c.writer.Write(c.record); err != nil {
+		return fmt.Errorf("error writing CSV row: %v", err)
+	}
+	return nil
+}
+
+func (c *csvRowWriter) Close() error {
+	c.writer.Flush()
+	if err := c.writer.Error(); err != nil {
+		return fmt.Errorf("error writing CSV: %v", err)
+	}
+	return nil
+}
+
+// ndjsonRowWriter writes one JSON object per line, with the columns in
+// catalog order. other_metadata is embedded as an object.
+type ndjsonRowWriter struct {
+	w *bufio.Writer
+}
+
+func (n *ndjsonRowWriter) Write(file FileInfo) error {
+	n.w.WriteByte('{')
+	for i, column := range exportColumns {
+		if i > 0 {
+			n.w.WriteByte(',')
+		}
+		name, _ := json.Marshal(column.name)
+		n.w.Write(name)
+		n.w.WriteByte(':')
+
+		var value interface{} = column.value(file)
+		switch column.kind {
+		case exportTime:
+			if value.(time.Time).IsZero() {
+				value = nil
+			}
+		case exportJSON:
+			if document := value.(string); document == "" {
+				value = nil
+			} else if json.Valid([]byte(document)) {
+				value = json.RawMessage(document)
+			}
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("error encoding %s: %v", column.name, err)
+		}
+		n.w.Write(data)
+	}
+	n.w.WriteByte('}')
+	if err := n.w.WriteByte('\n'); err != nil {
+		return fmt.Errorf("error writing JSON line: %v", err)
+	}
+	return nil
+}
+
+func (n *ndjsonRowWriter) Close() error {
+	if err := n.w.Flush(); err != nil {
+		return fmt.Errorf("error writing JSON lines: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io"
+	"math"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+func init() {
+	registerExtractor("exif", ExtractorFunc(extractEXIF),
+		[]string{"jpg", "jpeg", "jpe", "tif", "tiff"},
+		[]byte{0xFF, 0xD8, 0xFF}, []byte("II*\x00"), []byte("MM\x00*"))
+}
+
+// extractEXIF reports the camera, lens, exposure, taken date and GPS
+// position of a JPEG or TIFF image. Images without EXIF data report nothing.
+func extractEXIF(r io.ReaderAt, size int64) (map[string]interface{}, error) {
+	x, err := exif.Decode(io.NewSectionReader(r, 0, size))
+	if err != nil && (x == nil || exif.IsCriticalError(err)) {
+		return nil, nil
+	}
+
+	content := make(map[string]interface{})
+	for key, field := range map[string]exif.FieldName{
+		"camera_make":  exif.Make,
+		"camera_model": exif.Model,
+		"lens_model":   exif.LensModel,
+		"software":     exif.Software,
+	} {
+		if tag, err := x.Get(field); err == nil {
+			if value, err := tag.StringVal(); err == nil && value != "" {
+				content[key] = value
+			}
+		}
+	}
+	for key, field := range map[string]exif.FieldName{
+		"width":       exif.PixelXDimension,
+		"height":      exif.PixelYDimension,
+		"orientation": exif.Orientation,
+		"iso":         exif.ISOSpeedRatings,
+	} {
+		if tag, err := x.Get(field); err == nil {
+			if value, err := tag.Int(0); err == nil {
+				content[key] = value
+			}
+		}
+	}
+	for key, field := range map[string]exif.FieldName{
+		"exposure_time": exif.ExposureTime,
+		"f_number":      exif.FNumber,
+		"focal_length":  exif.FocalLength,
+	} {
+		if tag, err := x.Get(field); err == nil {
+			if num, den, err := tag.Rat2(0); err == nil && den != 0 {
+				content[key] = float64(num) / float64(den)
+			}
+		}
+	}
+
+	// The taken date has no time zone in most cameras, so it is stored as
+	// the wall clock time the camera recorded.
+	if taken, err := x.DateTime(); err == nil {
+		content["taken"] = taken.Format("2006-01-02T15:04:05")
+	}
+	if lat, long, err := x.LatLong(); err == nil && !math.IsNaN(lat) && !math.IsNaN(long) {
+		content["gps_latitude"] = lat
+		content["gps_longitude"] = long
+	}
+
+	if len(content) == 0 {
+		return nil, nil
+	}
+	return content, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+func init() {
+	registerExtractor("id3", ExtractorFunc(extractID3), []string{"mp3"}, []byte("ID3"))
+}
+
+// id3Frames maps the text frames worth keeping to their keys. ID3v2.2 uses
+// three-character frame IDs, later versions four.
+var id3Frames = map[string]string{
+	"TIT2": "title", "TT2": "title",
+	"TPE1": "artist", "TP1": "artist",
+	"TALB": "album", "TAL": "album",
+	"TPE2": "album_artist", "TP2": "album_artist",
+	"TRCK": "track", "TRK": "track",
+	"TYER": "year", "TYE": "year", "TDRC": "year",
+	"TCON": "genre", "TCO": "genre",
+	"TCOM": "composer", "TCM": "composer",
+}
+
+// id3MaxTagSize caps how much of a file is read for an ID3v2 tag. Cover art
+// can make tags large, but the text frames come first in practice.
+const id3MaxTagSize = 1 << 20
+
+// extractID3 reads the text frames of an ID3v2 tag, or the fixed fields of
+// an ID3v1 tag at the end of the file when there is no v2 tag.
+func extractID3(r io.ReaderAt, size int64) (map[string]interface{}, error) {
+	header := make([]byte, 10)
+	if _, err := r.ReadAt(header, 0); err == nil && string(header[:3]) == "ID3" {
+		return readID3v2(r, header)
+	}
+	return readID3v1(r, size)
+}
+
+func readID3v2(r io.ReaderAt, header []byte) (map[string]interface{}, error) {
+	version := header[3]
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("unsupported ID3 version 2.%d", version)
+	}
+	flags := header[5]
+	tagSize := syncsafeInt(header[6:10])
+	if tagSize > id3MaxTagSize {
+		tagSize = id3MaxTagSize
+	}
+	tag := make([]byte, tagSize)
+	n, err := r.ReadAt(tag, 10)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	tag = tag[:n]
+
+	// Before v2.4 unsynchronisation applies to the whole tag; undo it by
+	// dropping the zero byte inserted after every 0xFF.
+	if flags&0x80 != 0 && version < 4 {
+		tag = bytes.ReplaceAll(tag, []byte{0xFF, 0x00}, []byte{0xFF})
+	}
+	if flags&0x40 != 0 && version > 2 && len(tag) >= 4 {
+		extended := int(binary.BigEndian.Uint32(tag[:4]))
+		if version == 3 {
+			extended += 4 // the v2.3 size excludes the size field itself
+		} else {
+			extended = syncsafeInt(tag[:4])
+		}
+		if extended > len(tag) {
+			return nil, fmt.Errorf("invalid extended header")
+		}
+		tag = tag[extended:]
+	}
+
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+	content := make(map[string]interface{})
+	for len(tag) >= headerSize && tag[0] != 0 {
+		id := string(tag[:idSize])
+		var frameSize int
+		switch version {
+		case 2:
+			frameSize = int(tag[3])<<16 | int(tag[4])<<8 | int(tag[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(tag[4:8]))
+		default:
+			frameSize = syncsafeInt(tag[4:8])
+		}
+		if frameSize < 0 || headerSize+frameSize > len(tag) {
+			break
+		}
+		frame := tag[headerSize : headerSize+frameSize]
+		tag = tag[headerSize+frameSize:]
+
+		key, ok := id3Frames[id]
+		if !ok || len(frame) < 2 {
+			continue
+		}
+		if value := decodeID3Text(frame[0], frame[1:]); value != "" {
+			content[key] = value
+		}
+	}
+	content["version"] = fmt.Sprintf("2.%d", version)
+	return content, nil
+}
+
+func readID3v1(r io.ReaderAt, size int64) (map[string]interface{}, error) {
+	if size < 128 {
+		return nil, nil
+	}
+	tag := make([]byte, 128)
+	if _, err := r.ReadAt(tag, size-128); err != nil {
+		return nil, err
+	}
+	if string(tag[:3]) != "TAG" {
+		return nil, nil
+	}
+	content := map[string]interface{}{"version": "1"}
+	for key, field := range map[string][]byte{
+		"title":  tag[3:33],
+		"artist": tag[33:63],
+		"album":  tag[63:93],
+		"year":   tag[93:97],
+	} {
+		if value := latin1String(field); value != "" {
+			content[key] = value
+		}
+	}
+	// ID3v1.1 stores the track number in the last byte of the comment.
+	if tag[125] == 0 && tag[126] != 0 {
+		content["track"] = fmt.Sprint(tag[126])
+	}
+	return content, nil
+}
+
+// syncsafeInt decodes the 7-bits-per-byte integers of ID3v2 headers.
+func syncsafeInt(b []byte) int {
+	return int(b[0]&0x7F)<<21 | int(b[1]&0x7F)<<14 | int(b[2]&0x7F)<<7 | int(b[3]&0x7F)
+}
+
+// decodeID3Text decodes a text frame in one of the four ID3 encodings.
+// Multiple values are separated by " / ".
+func decodeID3Text(encoding byte, data []byte) string {
+	var values []string
+	switch encoding {
+	case 0:
+		values = strings.Split(latin1String(data), "\x00")
+	case 1, 2:
+		values = strings.Split(utf16String(data, encoding == 2), "\x00")
+	case 3:
+		values = strings.Split(string(data), "\x00")
+	default:
+		return ""
+	}
+	var kept []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			kept = append(kept, value)
+		}
+	}
+	return strings.Join(kept, " / ")
+}
+
+func latin1String(data []byte) string {
+	runes := make([]rune, 0, len(data))
+	for _, b := range data {
+		runes = append(runes, rune(b))
+	}
+	return strings.TrimSpace(strings.TrimRight(string(runes), "\x00"))
+}
+
+// utf16String decodes UTF-16 text. Each value may start with its own byte
+// order mark; without one, bigEndian decides.
+func utf16String(data []byte, bigEndian bool) string {
+	units := make([]uint16, 0, len(data)/2)
+	big := bigEndian
+	for i := 0; i+1 < len(data); i += 2 {
+		switch {
+		case data[i] == 0xFE && data[i+1] == 0xFF:
+			big = true
+			continue
+		case data[i] == 0xFF && data[i+1] == 0xFE:
+			big = false
+			continue
+		}
+		if big {
+			units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+		} else {
+			units = append(units, uint16(data[i+1])<<8|uint16(data[i]))
+		}
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+func init() {
+	// OOXML files are zip archives, so there are no magic bytes that tell
+	// them apart from any other zip; only extensions select this extractor.
+	registerExtractor("ooxml", ExtractorFunc(extractOOXML), []string{
+		"docx", "docm", "dotx", "xlsx", "xlsm", "xltx", "pptx", "pptm", "potx",
+	})
+}
+
+// ooxmlCore is docProps/core.xml. Element names are matched without their
+// namespaces (dc:, cp:, dcterms:).
+type ooxmlCore struct {
+	Title          string `xml:"title"`
+	Subject        string `xml:"subject"`
+	Creator        string `xml:"creator"`
+	Keywords       string `xml:"keywords"`
+	Description    string `xml:"description"`
+	LastModifiedBy string `xml:"lastModifiedBy"`
+	Revision       string `xml:"revision"`
+	Created        string `xml:"created"`
+	Modified       string `xml:"modified"`
+}
+
+// ooxmlApp is docProps/app.xml. Only the counts that apply to the kind of
+// document are present.
+type ooxmlApp struct {
+	Application string `xml:"Application"`
+	Company     string `xml:"Company"`
+	Pages       int    `xml:"Pages"`
+	Words       int    `xml:"Words"`
+	Slides      int    `xml:"Slides"`
+}
+
+// extractOOXML reads the document properties of Word, Excel and PowerPoint
+// files.
+func extractOOXML(r io.ReaderAt, size int64) (map[string]interface{}, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var core ooxmlCore
+	var app ooxmlApp
+	for _, file := range archive.File {
+		switch strings.ToLower(file.Name) {
+		case "docprops/core.xml":
+			err = decodeZipXML(file, &core)
+		case "docprops/app.xml":
+			err = decodeZipXML(file, &app)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	content := make(map[string]interface{})
+	for key, value := range map[string]string{
+		"title":            core.Title,
+		"subject":          core.Subject,
+		"author":           core.Creator,
+		"keywords":         core.Keywords,
+		"description":      core.Description,
+		"last_modified_by": core.LastModifiedBy,
+		"revision":         core.Revision,
+		"created":          core.Created,
+		"modified":         core.Modified,
+		"application":      app.Application,
+		"company":          app.Company,
+	} {
+		if value = strings.TrimSpace(value); value != "" {
+			content[key] = value
+		}
+	}
+	for key, value := range map[string]int{"pages": app.Pages, "words": app.Words, "slides": app.Slides} {
+		if value > 0 {
+			content[key] = value
+		}
+	}
+	if len(content) == 0 {
+		return nil, nil
+	}
+	return content, nil
+}
+
+// zipXMLLimit caps the size of a property part, which is a few KB in
+// practice, against zip bombs.
+const zipXMLLimit = 1 << 20
+
+func decodeZipXML(file *zip.File, v interface{}) error {
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(io.LimitReader(rc, zipXMLLimit)).Decode(v)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerExtractor("pdf", ExtractorFunc(extractPDF), []string{"pdf"}, []byte("%PDF-"))
+}
+
+// pdfMaxSize caps how much of a PDF is read. Larger files only report their
+// version, since the page tree can be anywhere in the file.
+const pdfMaxSize = 32 << 20
+
+// pdfMaxInflated caps the bytes inflated from all the object streams of one
+// file together, so that many small streams cannot each expand to the limit.
+const pdfMaxInflated = 32 << 20
+
+var (
+	pdfVersionPattern = regexp.MustCompile(`^%PDF-(\d\.\d)`)
+	pdfObjectPattern  = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+	pdfPagesPattern   = regexp.MustCompile(`/Type\s*/Pages\b`)
+	pdfCountPattern   = regexp.MustCompile(`/Count\s+(\d+)`)
+	pdfInfoPattern    = regexp.MustCompile(`/Info\s+(\d+)\s+\d+\s+R`)
+	pdfRefPattern     = regexp.MustCompile(`^(\d+)\s+\d+\s+R`)
+	pdfObjStmPattern  = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+	pdfIntPattern     = regexp.MustCompile(`/(N|First)\s+(\d+)`)
+)
+
+// extractPDF reports the version, page count, title and author of a PDF.
+// This is not a full PDF parser: it scans the file for objects, including
+// those in compressed object streams, and does not follow the cross-reference
+// table. That is enough for the files office software and printers produce.
+func extractPDF(r io.ReaderAt, size int64) (map[string]interface{}, error) {
+	header := make([]byte, 16)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	match := pdfVersionPattern.FindSubmatch(header[:n])
+	if match == nil {
+		return nil, nil
+	}
+	content := map[string]interface{}{"version": string(match[1])}
+	if size > pdfMaxSize {
+		return content, nil
+	}
+
+	data := make([]byte, size)
+	if _, err := r.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	objects := pdfObjects(data)
+
+	pages := 0
+	for _, body := range objects {
+		if !pdfPagesPattern.Match(body) {
+			continue
+		}
+		// Nested page tree nodes count only their own pages, so the root
+		// has the largest count.
+		if match := pdfCountPattern.FindSubmatch(body); match != nil {
+			if count, err := strconv.Atoi(string(match[1])); err == nil && count > pages {
+				pages = count
+			}
+		}
+	}
+	if pages > 0 {
+		content["pages"] = pages
+	}
+
+	// Strings in an encrypted document cannot be read without decrypting
+	// them, so only the structure is reported.
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		content["encrypted"] = true
+		return content, nil
+	}
+	infos := pdfInfoPattern.FindAllSubmatch(data, -1)
+	if len(infos) == 0 {
+		return content, nil
+	}
+	// Incremental updates append a new trailer, so the last one wins.
+	info := objects[string(infos[len(infos)-1][1])]
+	for key, name := range map[string]string{
+		"title":    "/Title",
+		"author":   "/Author",
+		"subject":  "/Subject",
+		"creator":  "/Creator",
+		"producer": "/Producer",
+	} {
+		if value := pdfDictString(info, name, objects); value != "" {
+			content[key] = value
+		}
+	}
+	return content, nil
+}
+
+// pdfObjects returns the body of every object in the file by object number.
+// Later definitions replace earlier ones, as incremental updates do.
+func pdfObjects(data []byte) map[string][]byte {
+	objects := make(map[string][]byte)
+	matches := pdfObjectPattern.FindAllSubmatchIndex(data, -1)
+	for i, match := range matches {
+		end := len(data)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		body := data[match[1]:end]
+		if j := bytes.Index(body, []byte("endobj")); j >= 0 {
+			body = body[:j]
+		}
+		objects[string(data[match[2]:match[3]])] = body
+	}
+
+	// Streams are unpacked in file order, so the ones a truncated file or
+	// the inflate limit leaves out are always the same.
+	var streams [][]byte
+	unpacked := make(map[string]bool)
+	for _, match := range matches {
+		number := string(data[match[2]:match[3]])
+		if body := objects[number]; !unpacked[number] && pdfObjStmPattern.Match(body) {
+			unpacked[number] = true
+			streams = append(streams, body)
+		}
+	}
+	budget := int64(pdfMaxInflated)
+	for _, body := range streams {
+		if budget <= 0 {
+			break
+		}
+		streamObjects, inflated := pdfObjectStream(body, budget)
+		budget -= inflated
+		for number, object := range streamObjects {
+			if _, ok := objects[number]; !ok {
+				objects[number] = object
+			}
+		}
+	}
+	return objects
+}
+
+// pdfObjectStream unpacks a compressed object stream, inflating at most limit
+// bytes, and returns its objects with the number of bytes inflated. Streams
+// that are not Flate encoded are skipped.
+func pdfObjectStream(body []byte, limit int64) (map[string][]byte, int64) {
+	start := bytes.Index(body, []byte("stream"))
+	end := bytes.LastIndex(body, []byte("endstream"))
+	if start < 0 || end < start || !bytes.Contains(body[:start], []byte("/FlateDecode")) {
+		return nil, 0
+	}
+	dict := body[:start]
+	var count, first int
+	for _, match := range pdfIntPattern.FindAllSubmatch(dict, -1) {
+		value, _ := strconv.Atoi(string(match[2]))
+		if string(match[1]) == "N" {
+			count = value
+		} else {
+			first = value
+		}
+	}
+
+	raw := body[start+len("stream") : end]
+	raw = bytes.TrimLeft(raw, "\r\n")
+	zr, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, 0
+	}
+	defer zr.Close()
+	stream, err := io.ReadAll(io.LimitReader(zr, limit))
+	inflated := int64(len(stream))
+	if (err != nil && len(stream) == 0) || first > len(stream) {
+		return nil, inflated
+	}
+
+	// The stream starts with pairs of object number and offset relative to
+	// First.
+	fields := bytes.Fields(stream[:first])
+	objects := make(map[string][]byte)
+	for i := 0; i < count && 2*i+1 < len(fields); i++ {
+		offset, err := strconv.Atoi(string(fields[2*i+1]))
+		if err != nil {
+			return objects, inflated
+		}
+		next := len(stream) - first
+		if 2*i+3 < len(fields) {
+			if n, err := strconv.Atoi(string(fields[2*i+3])); err == nil {
+				next = n
+			}
+		}
+		if offset < 0 || offset > next || first+next > len(stream) {
+			return objects, inflated
+		}
+		objects[string(fields[2*i])] = stream[first+offset : first+next]
+	}
+	return objects, inflated
+}
+
+// pdfDictString returns the string stored under name in a dictionary,
+// following an indirect reference if the value is one.
+func pdfDictString(dict []byte, name string, objects map[string][]byte) string {
+	for i := 0; ; {
+		j := bytes.Index(dict[i:], []byte(name))
+		if j < 0 {
+			return ""
+		}
+		i += j + len(name)
+		if i < len(dict) && !pdfDelimiter(dict[i]) {
+			continue // a longer name such as /TitleSort
+		}
+		value := bytes.TrimLeft(dict[i:], " \t\r\n")
+		if match := pdfRefPattern.FindSubmatch(value); match != nil {
+			value = bytes.TrimLeft(objects[string(match[1])], " \t\r\n")
+		}
+		return decodePDFText(pdfString(value))
+	}
+}
+
+func pdfDelimiter(b byte) bool {
+	return bytes.IndexByte([]byte(" \t\r\n\f()<>[]{}/%"), b) >= 0
+}
+
+// pdfString parses the literal or hexadecimal string at the start of data.
+func pdfString(data []byte) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+	switch data[0] {
+	case '(':
+		return pdfLiteralString(data[1:])
+	case '<':
+		end := bytes.IndexByte(data, '>')
+		if end < 0 || bytes.HasPrefix(data, []byte("<<")) {
+			return nil
+		}
+		digits := bytes.Join(bytes.Fields(data[1:end]), nil)
+		if len(digits)%2 == 1 {
+			digits = append(digits, '0')
+		}
+		out := make([]byte, 0, len(digits)/2)
+		for i := 0; i+1 < len(digits); i += 2 {
+			b, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+			if err != nil {
+				return nil
+			}
+			out = append(out, byte(b))
+		}
+		return out
+	}
+	return nil
+}
+
+// pdfLiteralString decodes a parenthesised string, whose opening parenthesis
+// has been consumed. Balanced parentheses may appear unescaped.
+func pdfLiteralString(data []byte) []byte {
+	var out []byte
+	depth := 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth == 0 {
+				return out
+			}
+			depth--
+		case c == '\\' && i+1 < len(data):
+			i++
+			switch e := data[i]; e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// A backslash at the end of a line continues the string.
+				if e == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+					i++
+				}
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					value := 0
+					for k := 0; k < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7'; k++ {
+						value = value*8 + int(data[i]-'0')
+						i++
+					}
+					i--
+					c = byte(value)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// decodePDFText converts a PDF text string, which is UTF-16BE with a byte
+// order mark or PDFDocEncoding (treated as Latin-1), to UTF-8.
+func decodePDFText(data []byte) string {
+	if len(data) >= 2 && data[0] == 0xFE && data[1] == 0xFF {
+		return strings.TrimSpace(strings.TrimRight(utf16String(data[2:], true), "\x00"))
+	}
+	return latin1String(data)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"testing"
+)
+
+// pdfObjStm returns an object stream holding the given objects, keyed by
+// object number, followed by padding zero bytes.
+func pdfObjStm(t *testing.T, number int, objects map[int]string, padding int) string {
+	t.Helper()
+	var header, bodies bytes.Buffer
+	for n, body := range objects {
+		fmt.Fprintf(&header, "%d %d ", n, bodies.Len())
+		bodies.WriteString(body)
+	}
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(header.Bytes())
+	zw.Write(bodies.Bytes())
+	zw.Write(make([]byte, padding))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("%d 0 obj\n<< /Type /ObjStm /N %d /First %d /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream\nendobj\n",
+		number, len(objects), header.Len(), compressed.Len(), compressed.Bytes())
+}
+
+func TestExtractPDFObjectStreams(t *testing.T) {
+	// The padding makes zlib encode the objects rather than store them, so
+	// they can only be found by inflating the stream.
+	catalog := pdfObjStm(t, 10, map[int]string{
+		2: "<< /Type /Pages /Kids [3 0 R] /Count 7 >>",
+		4: "<< /Title (Quarterly report) >>",
+	}, 4096)
+	if bytes.Contains([]byte(catalog), []byte("/Pages")) {
+		t.Fatalf("object stream holds its objects uncompressed")
+	}
+	tests := []struct {
+		name      string
+		streams   []string
+		wantPages bool
+	}{
+		{"one stream", []string{catalog}, true},
+		{"after small streams", []string{pdfObjStm(t, 11, nil, 1<<20), catalog}, true},
+		{"after the inflate limit", []string{
+			pdfObjStm(t, 11, nil, pdfMaxInflated/2),
+			pdfObjStm(t, 12, nil, pdfMaxInflated/2),
+			catalog,
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pdf := "%PDF-1.7\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n"
+			for _, stream := range test.streams {
+				pdf += stream
+			}
+			pdf += "trailer\n<< /Root 1 0 R /Info 4 0 R >>\n%%EOF\n"
+
+			content, err := extractPDF(bytes.NewReader([]byte(pdf)), int64(len(pdf)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content["version"] != "1.7" {
+				t.Errorf("version %v, want 1.7", content["version"])
+			}
+			if test.wantPages {
+				if content["pages"] != 7 || content["title"] != "Quarterly report" {
+					t.Errorf("got %v, want 7 pages and the title from the object stream", content)
+				}
+			} else if _, ok := content["pages"]; ok {
+				t.Errorf("got %v, want no pages once the streams before it used up the limit", content)
+			}
+		})
+	}
+}
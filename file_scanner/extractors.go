@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// Extractor reads type-specific metadata from a file's content, such as the
+// EXIF tags of a photo. Extract returns the fields to store, or nil when the
+// file has nothing to report.
+type Extractor interface {
+	Extract(r io.ReaderAt, size int64) (map[string]interface{}, error)
+}
+
+// ExtractorFunc adapts an ordinary function to Extractor.
+type ExtractorFunc func(r io.ReaderAt, size int64) (map[string]interface{}, error)
+
+func (f ExtractorFunc) Extract(r io.ReaderAt, size int64) (map[string]interface{}, error) {
+	return f(r, size)
+}
+
+type registeredExtractor struct {
+	name      string
+	extractor Extractor
+	magic     [][]byte
+}
+
+var (
+	extractorsByExtension = make(map[string]*registeredExtractor)
+	extractorsByMagic     []*registeredExtractor
+)
+
+// magicHeaderSize is how much of a file is read to match magic bytes.
+const magicHeaderSize = 16
+
+// registerExtractor makes an extractor available to scans under name, which
+// is stored with its results. It is chosen for files with one of the given
+// extensions (without the dot, any case), and for files whose extension has
+// no extractor when their content starts with one of the magic prefixes.
+// Extractors register themselves from init functions.
+func registerExtractor(name string, extractor Extractor, extensions []string, magic ...[]byte) {
+	entry := &registeredExtractor{name: name, extractor: extractor, magic: magic}
+	for _, extension := range extensions {
+		extractorsByExtension[strings.ToLower(extension)] = entry
+	}
+	if len(magic) > 0 {
+		extractorsByMagic = append(extractorsByMagic, entry)
+	}
+}
+
+func extractorForMagic(header []byte) *registeredExtractor {
+	for _, entry := range extractorsByMagic {
+		for _, magic := range entry.magic {
+			if bytes.HasPrefix(header, magic) {
+				return entry
+			}
+		}
+	}
+	return nil
+}
+
+// extractContent runs the extractor registered for the file, if any, and
+// returns its name and results. Extractors parse untrusted files, so a panic
+// in one is reported as an error rather than ending the scan.
+func extractContent(path, extension string) (name string, content map[string]interface{}, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", nil, fmt.Errorf("error getting file info: %v", err)
+	}
+
+	entry := extractorsByExtension[strings.ToLower(strings.TrimPrefix(extension, "."))]
+	if entry == nil {
+		header := make([]byte, magicHeaderSize)
+		n, _ := io.ReadFull(file, header)
+		entry = extractorForMagic(header[:n])
+	}
+	if entry == nil {
+		return "", nil, nil
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			content = nil
+			err = fmt.Errorf("%s extractor failed: %v", entry.name, r)
+		}
+	}()
+	content, err = entry.extractor.Extract(file, info.Size())
+	if err != nil {
+		return entry.name, nil, fmt.Errorf("%s extractor failed: %v", entry.name, err)
+	}
+	return entry.name, content, nil
+}
+
+// addContent runs the file's extractor and stores its results. Failures are
+// logged; the rest of the metadata is still recorded.
+func (m *FileMetadata) addContent(path, extension string) {
+	name, content, err := extractContent(path, extension)
+	if err != nil {
+		log.Printf("Error extracting metadata from %s: %v", path, err)
+		return
+	}
+	if len(content) > 0 {
+		m.Extractor = name
+		m.Content = content
+	}
+}
+
+// addContentMetadata runs the extractor for a file whose OtherMetadata was
+// collected without it.
+func addContentMetadata(file *FileInfo) {
+	var metadata FileMetadata
+	if err := json.Unmarshal([]byte(file.OtherMetadata), &metadata); err != nil {
+		log.Printf("Error reading metadata of %s: %v", file.FilePath, err)
+		return
+	}
+	if !strings.HasPrefix(metadata.Mode, "-") {
+		return // only regular files have content to extract
+	}
+	metadata.addContent(file.FilePath, file.Extension)
+	file.OtherMetadata = encodeMetadata(metadata)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// fileSink is the "files" backend: it writes scan results to CSV or NDJSON
+// files in a directory instead of a database, one series of numbered files
+// per catalog, e.g. "shares-00001.csv.gz". Each scan starts a new file and
+// a file is closed for the next once it reaches the rotation size, so scans
+// never overwrite earlier output. Rows are appended as they come, so a file
+// can hold a path more than once if a scan is resumed. The sink cannot be
+// read back, so incremental scans, watch mode and the reports need a
+// database.
+type fileSink struct {
+	mu          sync.Mutex
+	dir         string
+	format      string
+	compression string
+	rotateSize  int64
+	outputs     map[string]*sinkOutput
+}
+
+// sinkOutput is the file a catalog is currently written to.
+type sinkOutput struct {
+	file       *os.File
+	counter    *countingWriter
+	compressor io.WriteCloser
+	rows       rowWriter
+}
+
+// sinkFormats and sinkCompressions list the choices of the files backend.
+var (
+	sinkFormats      = []string{"csv", "ndjson"}
+	sinkCompressions = []string{"", "gzip", "zstd"}
+)
+
+func openFileSink(cfg ConnectionConfig) (Storage, error) {
+	if cfg.Database == "" {
+		return nil, fmt.Errorf("no output directory given")
+	}
+	format := cfg.FileFormat
+	if format == "" {
+		format = sinkFormats[0]
+	}
+	if !containsString(sinkFormats, format) {
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+	if !containsString(sinkCompressions, cfg.Compression) {
+		return nil, fmt.Errorf("unknown compression %q", cfg.Compression)
+	}
+	if cfg.RotateSize < 0 {
+		return nil, fmt.Errorf("rotation size cannot be negative")
+	}
+	if err := os.MkdirAll(cfg.Database, 0755); err != nil {
+		return nil, fmt.Errorf("error creating output directory: %v", err)
+	}
+
+	log.Printf("Writing scan results to %s files in %s", format, cfg.Database)
+	return &fileSink{
+		dir:         cfg.Database,
+		format:      format,
+		compression: cfg.Compression,
+		rotateSize:  cfg.RotateSize,
+		outputs:     make(map[string]*sinkOutput),
+	}, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// suffix is the file name extension of the sink's files.
+func (s *fileSink) suffix() string {
+	switch s.compression {
+	case "gzip":
+		return "." + s.format + ".gz"
+	case "zstd":
+		return "." + s.format + ".zst"
+	}
+	return "." + s.format
+}
+
+// CreateCatalog checks that the name can be used in file names. Files are
+// only created once rows are written.
+func (s *fileSink) CreateCatalog(name string) error {
+	if name == "" || name != filepath.Base(name) || strings.ContainsAny(name, `/\:*?"<>|`) {
+		return fmt.Errorf("invalid table name %q for file output", name)
+	}
+	return nil
+}
+
+// ListCatalogs returns the catalogs that have files in the directory.
+func (s *fileSink) ListCatalogs() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error listing output directory: %v", err)
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, entry := range entries {
+		if name, _, ok := s.parseFileName(entry.Name()); ok && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// parseFileName splits a file name of the sink into catalog and sequence.
+func (s *fileSink) parseFileName(fileName string) (string, int, bool) {
+	base := strings.TrimSuffix(fileName, s.suffix())
+	i := strings.LastIndexByte(base, '-')
+	if base == fileName || i <= 0 {
+		return "", 0, false
+	}
+	sequence, err := strconv.Atoi(base[i+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	return base[:i], sequence, true
+}
+
+// nextFile returns the path of the next file in the catalog's series.
+func (s *fileSink) nextFile(name string) (string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return "", fmt.Errorf("error listing output directory: %v", err)
+	}
+	last := 0
+	for _, entry := range entries {
+		if catalog, sequence, ok := s.parseFileName(entry.Name()); ok && catalog == name && sequence > last {
+			last = sequence
+		}
+	}
+	return filepath.Join(s.dir, fmt.Sprintf("%s-%05d%s", name, last+1, s.suffix())), nil
+}
+
+func (s *fileSink) open(name string) (*sinkOutput, error) {
+	path, err := s.nextFile(name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error creating output file: %v", err)
+	}
+	out := &sinkOutput{file: file, counter: &countingWriter{w: file}}
+	var w io.Writer = out.counter
+	switch s.compression {
+	case "gzip":
+		out.compressor = gzip.NewWriter(out.counter)
+	case "zstd":
+		if out.compressor, err = zstd.NewWriter(out.counter); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("error starting zstd compression: %v", err)
+		}
+	}
+	if out.compressor != nil {
+		w = out.compressor
+	}
+	if out.rows, err = newRowWriter(w, s.format); err != nil {
+		file.Close()
+		return nil, err
+	}
+	log.Printf("Writing to %s", path)
+	return out, nil
+}
+
+func (o *sinkOutput) close() error {
+	err := o.rows.Close()
+	if o.compressor != nil {
+		if cerr := o.compressor.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("error compressing output file: %v", cerr)
+		}
+	}
+	if cerr := o.file.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("error closing output file: %v", cerr)
+	}
+	return err
+}
+
+// UpsertBatch appends the files to the catalog's current file, moving on to
+// a new one afterwards if it has reached the rotation size. The size is
+// measured after compression, so it lags by what the compressor buffers.
+func (s *fileSink) UpsertBatch(name string, files []FileInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out, ok := s.outputs[name]
+	if !ok {
+		var err error
+		if out, err = s.open(name); err != nil {
+			return err
+		}
+		s.outputs[name] = out
+	}
+	for _, file := range files {
+		if err := out.rows.Write(file); err != nil {
+			return err
+		}
+	}
+	log.Printf("Successfully wrote %d files to %s", len(files), out.file.Name())
+	if s.rotateSize > 0 && out.counter.n >= s.rotateSize {
+		delete(s.outputs, name)
+		return out.close()
+	}
+	return nil
+}
+
+// Finalize closes the catalog's file, so the next scan starts a new one.
+func (s *fileSink) Finalize(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out, ok := s.outputs[name]
+	if !ok {
+		return nil
+	}
+	delete(s.outputs, name)
+	return out.close()
+}
+
+// Close closes every open file. Files of an interrupted scan are complete
+// up to the last batch written.
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var firstErr error
+	for name, out := range s.outputs {
+		if err := out.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.outputs, name)
+	}
+	return firstErr
+}
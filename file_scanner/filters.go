@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FilterRules limit which files a scan records. Patterns use path.Match
+// syntax and are matched against the file or directory name, or, when they
+// contain a "/", against the slash-separated path relative to the scanned
+// folder. Empty fields do not filter.
+type FilterRules struct {
+	// Include keeps only files matching at least one pattern.
+	Include []string `json:"include,omitempty"`
+	// Exclude drops files matching any pattern.
+	Exclude []string `json:"exclude,omitempty"`
+	// Extensions keeps only files with one of these extensions, and
+	// ExcludeExtensions drops them. Both ignore case and the leading dot.
+	Extensions        []string `json:"extensions,omitempty"`
+	ExcludeExtensions []string `json:"exclude_extensions,omitempty"`
+	// MinSize and MaxSize bound the file size in bytes. Zero means no bound.
+	MinSize int64 `json:"min_size,omitempty"`
+	MaxSize int64 `json:"max_size,omitempty"`
+	// ModifiedAfter and ModifiedBefore bound the modification time.
+	ModifiedAfter  time.Time `json:"modified_after,omitempty"`
+	ModifiedBefore time.Time `json:"modified_before,omitempty"`
+	// PruneDirs skips matching directories and everything below them, e.g.
+	// ".git", "$RECYCLE.BIN" or "node_modules".
+	PruneDirs []string `json:"prune_dirs,omitempty"`
+}
+
+// errFiltered is returned by processFile for files the filter rules drop.
+var errFiltered = errors.New("file excluded by filter rules")
+
+// active reports whether any rule is set.
+func (r FilterRules) active() bool {
+	return len(r.Include) > 0 || len(r.Exclude) > 0 || len(r.Extensions) > 0 ||
+		len(r.ExcludeExtensions) > 0 || r.MinSize > 0 || r.MaxSize > 0 ||
+		!r.ModifiedAfter.IsZero() || !r.ModifiedBefore.IsZero() || len(r.PruneDirs) > 0
+}
+
+func (r FilterRules) validate() error {
+	for _, patterns := range [][]string{r.Include, r.Exclude, r.PruneDirs} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid filter pattern %q: %v", pattern, err)
+			}
+		}
+	}
+	if r.MinSize < 0 || r.MaxSize < 0 {
+		return fmt.Errorf("file size limits cannot be negative")
+	}
+	if r.MaxSize > 0 && r.MinSize > r.MaxSize {
+		return fmt.Errorf("minimum file size is larger than the maximum")
+	}
+	if !r.ModifiedAfter.IsZero() && !r.ModifiedBefore.IsZero() && !r.ModifiedAfter.Before(r.ModifiedBefore) {
+		return fmt.Errorf("modified-after date is not before the modified-before date")
+	}
+	return nil
+}
+
+// matchPattern matches a pattern against the name or relative path of an
+// entry below root. Matching uses path.Match on the slash-separated path so
+// that "*" never crosses a "/", on Windows as elsewhere.
+func matchPattern(pattern, root, name string) bool {
+	if strings.Contains(pattern, "/") {
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return false
+		}
+		matched, _ := path.Match(pattern, filepath.ToSlash(rel))
+		return matched
+	}
+	matched, _ := path.Match(pattern, filepath.Base(name))
+	return matched
+}
+
+func matchAny(patterns []string, root, path string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, root, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneDir reports whether the walk should skip the directory at path.
+func (r FilterRules) pruneDir(root, path string) bool {
+	return path != root && matchAny(r.PruneDirs, root, path)
+}
+
+// prunedPath reports whether any directory between root and the file at
+// path is pruned, for paths that did not come from a walk.
+func (r FilterRules) prunedPath(root, path string) bool {
+	if len(r.PruneDirs) == 0 {
+		return false
+	}
+	for dir := filepath.Dir(path); dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+		if r.pruneDir(root, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchName applies the rules that only need the path, so a walk can drop
+// files before they are opened.
+func (r FilterRules) matchName(root, path string) bool {
+	if len(r.Include) > 0 && !matchAny(r.Include, root, path) {
+		return false
+	}
+	if matchAny(r.Exclude, root, path) {
+		return false
+	}
+	extension := strings.TrimPrefix(filepath.Ext(path), ".")
+	if len(r.Extensions) > 0 && !hasExtension(r.Extensions, extension) {
+		return false
+	}
+	return !hasExtension(r.ExcludeExtensions, extension)
+}
+
+// matchInfo applies the size and date rules.
+func (r FilterRules) matchInfo(size int64, modTime time.Time) bool {
+	if size < r.MinSize || (r.MaxSize > 0 && size > r.MaxSize) {
+		return false
+	}
+	if !r.ModifiedAfter.IsZero() && modTime.Before(r.ModifiedAfter) {
+		return false
+	}
+	return r.ModifiedBefore.IsZero() || modTime.Before(r.ModifiedBefore)
+}
+
+func hasExtension(extensions []string, extension string) bool {
+	for _, candidate := range extensions {
+		if strings.EqualFold(strings.TrimPrefix(candidate, "."), extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma-separated list as typed in a flag or form field.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseSize reads a byte count with an optional binary unit, e.g. "500",
+// "64KB" or "1.5 GB". An empty string is zero.
+func parseSize(text string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(text))
+	if s == "" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	for i, unit := range []string{"KB", "MB", "GB", "TB"} {
+		if strings.HasSuffix(s, unit) {
+			multiplier = int64(1) << (10 * (i + 1))
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit))
+			break
+		}
+	}
+	s = strings.TrimSpace(strings.TrimSuffix(s, "B"))
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", text)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// parseDate reads a date as YYYY-MM-DD in local time, or an RFC 3339
+// timestamp. An empty string is the zero time.
+func parseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, use YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// formatSize is the inverse of parseSize, using the largest unit that
+// divides n exactly. Zero is an empty string.
+func formatSize(n int64) string {
+	if n == 0 {
+		return ""
+	}
+	units := []string{"TB", "GB", "MB", "KB"}
+	for i, unit := range units {
+		size := int64(1) << (10 * (len(units) - i))
+		if n%size == 0 {
+			return strconv.FormatInt(n/size, 10) + unit
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// formatDate is the inverse of parseDate.
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	local := t.In(time.Local)
+	if local.Hour() == 0 && local.Minute() == 0 && local.Second() == 0 && local.Nanosecond() == 0 {
+		return local.Format("2006-01-02")
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilterRulesMatchName(t *testing.T) {
+	root := filepath.Join("data", "root")
+	tests := []struct {
+		name  string
+		rules FilterRules
+		path  string
+		want  bool
+	}{
+		{"no rules", FilterRules{}, "a.txt", true},
+		{"include by name", FilterRules{Include: []string{"*.txt"}}, "sub/a.txt", true},
+		{"include misses", FilterRules{Include: []string{"*.txt"}}, "sub/a.log", false},
+		{"include by path", FilterRules{Include: []string{"sub/*"}}, "sub/a.log", true},
+		{"include by path misses a deeper file", FilterRules{Include: []string{"sub/*"}}, "sub/deep/a.log", false},
+		{"exclude by name", FilterRules{Exclude: []string{"*.tmp"}}, "sub/a.tmp", false},
+		{"exclude misses", FilterRules{Exclude: []string{"*.tmp"}}, "sub/a.txt", true},
+		{"exclude by path", FilterRules{Exclude: []string{"build/*"}}, "build/a", false},
+		{"star does not cross a slash", FilterRules{Exclude: []string{"build/*"}}, "build/a/b/c", true},
+		{"exclude wins over include", FilterRules{Include: []string{"*.txt"}, Exclude: []string{"secret*"}}, "secret.txt", false},
+		{"extension", FilterRules{Extensions: []string{"pdf"}}, "a.pdf", true},
+		{"extension ignores case and dot", FilterRules{Extensions: []string{".PDF"}}, "a.pdf", true},
+		{"extension misses", FilterRules{Extensions: []string{"pdf"}}, "a.docx", false},
+		{"no extension", FilterRules{Extensions: []string{"pdf"}}, "Makefile", false},
+		{"excluded extension", FilterRules{ExcludeExtensions: []string{"iso"}}, "disk.ISO", false},
+		{"other extension", FilterRules{ExcludeExtensions: []string{"iso"}}, "disk.img", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(root, filepath.FromSlash(test.path))
+			if got := test.rules.matchName(root, path); got != test.want {
+				t.Errorf("matchName(%s) = %t, want %t", test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterRulesPruneDir(t *testing.T) {
+	root := filepath.Join("data", "root")
+	tests := []struct {
+		prune []string
+		path  string
+		want  bool
+	}{
+		{[]string{"node_modules"}, "web/node_modules", true},
+		{[]string{"node_modules"}, "web/modules", false},
+		{[]string{".git"}, ".git", true},
+		{[]string{"build/*"}, "build/out", true},
+		{[]string{"build/*"}, "build/out/deep", false},
+		{[]string{"*"}, "", false},
+	}
+	for _, test := range tests {
+		path := filepath.Join(root, filepath.FromSlash(test.path))
+		if got := (FilterRules{PruneDirs: test.prune}).pruneDir(root, path); got != test.want {
+			t.Errorf("pruneDir(%v, %q) = %t, want %t", test.prune, test.path, got, test.want)
+		}
+	}
+
+	rules := FilterRules{PruneDirs: []string{"node_modules"}}
+	if !rules.prunedPath(root, filepath.Join(root, "web", "node_modules", "lib", "a.js")) {
+		t.Errorf("a file below node_modules is not pruned")
+	}
+	if rules.prunedPath(root, filepath.Join(root, "web", "lib", "a.js")) {
+		t.Errorf("a file outside node_modules is pruned")
+	}
+}
+
+func TestFilterRulesMatchInfo(t *testing.T) {
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	inside := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		rules   FilterRules
+		size    int64
+		modTime time.Time
+		want    bool
+	}{
+		{"no rules", FilterRules{}, 0, inside, true},
+		{"at the minimum size", FilterRules{MinSize: 100}, 100, inside, true},
+		{"below the minimum size", FilterRules{MinSize: 100}, 99, inside, false},
+		{"at the maximum size", FilterRules{MaxSize: 100}, 100, inside, true},
+		{"above the maximum size", FilterRules{MaxSize: 100}, 101, inside, false},
+		{"zero maximum is no bound", FilterRules{MinSize: 1}, 1 << 40, inside, true},
+		{"modified after", FilterRules{ModifiedAfter: after}, 0, inside, true},
+		{"at the modified-after date", FilterRules{ModifiedAfter: after}, 0, after, true},
+		{"too old", FilterRules{ModifiedAfter: after}, 0, after.Add(-time.Second), false},
+		{"modified before", FilterRules{ModifiedBefore: before}, 0, inside, true},
+		{"at the modified-before date", FilterRules{ModifiedBefore: before}, 0, before, false},
+		{"between the dates", FilterRules{ModifiedAfter: after, ModifiedBefore: before}, 0, inside, true},
+		{"size and date both apply", FilterRules{MinSize: 10, ModifiedAfter: after}, 5, inside, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.rules.matchInfo(test.size, test.modTime); got != test.want {
+				t.Errorf("matchInfo(%d, %s) = %t, want %t", test.size, test.modTime, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterRulesValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   FilterRules
+		wantErr bool
+	}{
+		{"empty", FilterRules{}, false},
+		{"bad pattern", FilterRules{Exclude: []string{"[a-"}}, true},
+		{"bad prune pattern", FilterRules{PruneDirs: []string{"["}}, true},
+		{"negative size", FilterRules{MinSize: -1}, true},
+		{"minimum above maximum", FilterRules{MinSize: 10, MaxSize: 5}, true},
+		{"dates out of order", FilterRules{
+			ModifiedAfter:  time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			ModifiedBefore: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.rules.validate(); (err != nil) != test.wantErr {
+				t.Errorf("validate() = %v, want an error %t", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,1025 @@
+//go:build !headless
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/app"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+func runGUI() {
+	myApp := app.New()
+	myWindow := myApp.NewWindow("File Scanner")
+
+	serverEntry := widget.NewEntry()
+	serverEntry.SetPlaceHolder("Server")
+
+	portEntry := widget.NewEntry()
+	portEntry.SetPlaceHolder("Port (default 1433)")
+
+	usernameEntry := widget.NewEntry()
+	usernameEntry.SetPlaceHolder("Username")
+
+	passwordEntry := widget.NewPasswordEntry()
+	passwordEntry.SetPlaceHolder("Password")
+
+	// The password is remembered in the OS keyring, encrypted with a master
+	// password, or not at all.
+	masterPasswordEntry := widget.NewPasswordEntry()
+	masterPasswordEntry.SetPlaceHolder("Master Password")
+	passwordStoreSelect := widget.NewSelect(passwordStoreLabels(), nil)
+	passwordStoreSelect.SetSelected(passwordStoreLabel(passwordKeyring))
+
+	// SQL Server can also log in with Windows or Kerberos credentials, or
+	// as an Azure AD identity, which have settings of their own.
+	authSelect := widget.NewSelect(authLabels(), nil)
+	realmEntry := widget.NewEntry()
+	realmEntry.SetPlaceHolder("Kerberos Realm (blank for the default)")
+	krb5ConfigEntry := widget.NewEntry()
+	krb5ConfigEntry.SetPlaceHolder("krb5.conf Path (blank for the default)")
+	keytabEntry := widget.NewEntry()
+	keytabEntry.SetPlaceHolder("Keytab Path (blank to use the password)")
+	tenantEntry := widget.NewEntry()
+	tenantEntry.SetPlaceHolder("Tenant ID (blank for the server's)")
+	kerberosOptions := container.NewGridWithColumns(3, realmEntry, krb5ConfigEntry, keytabEntry)
+
+	// How SQL Server connections are encrypted and the server certificate
+	// checked. The certificate settings need full encryption.
+	encryptSelect := widget.NewSelect(encryptLabels(), nil)
+	trustCertCheck := widget.NewCheck("Trust server certificate (skip the CA and host name checks)", nil)
+	tlsCAEntry := widget.NewEntry()
+	tlsCAEntry.SetPlaceHolder("CA Bundle Path (blank for the system CAs)")
+	tlsHostnameEntry := widget.NewEntry()
+	tlsHostnameEntry.SetPlaceHolder("Host Name in Certificate (blank for the server)")
+	tlsPinEntry := widget.NewEntry()
+	tlsPinEntry.SetPlaceHolder("Pinned SHA-256 Fingerprints, comma-separated")
+	certificateOptions := container.NewGridWithColumns(3, tlsCAEntry, tlsHostnameEntry, tlsPinEntry)
+	// PostgreSQL has its own TLS modes.
+	sslModeSelect := widget.NewSelect(sslModeLabels(), nil)
+	sslModeSelect.SetSelected(sslModeLabel(sslRequire))
+
+	dbNameEntry := widget.NewEntry()
+	dbNameEntry.SetPlaceHolder("Database Name")
+
+	// The SQLite backend only needs a file, so the server fields are hidden
+	// while it is selected and the database entry takes the .db path.
+	dbFileButton := widget.NewButton("Choose Database File", func() {
+		dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				log.Printf("Error opening file dialog: %v", err)
+				dialog.ShowError(err, myWindow)
+				return
+			}
+			if writer != nil {
+				writer.Close()
+				dbNameEntry.SetText(writer.URI().Path())
+				log.Printf("Selected SQLite database file: %s", writer.URI().Path())
+			}
+		}, myWindow)
+	})
+	// The files backend writes to a directory instead, with its own format,
+	// compression and rotation settings.
+	outputDirButton := widget.NewButton("Choose Output Folder", func() {
+		dialog.ShowFolderOpen(func(uri fyne.ListableURI, err error) {
+			if err != nil {
+				log.Printf("Error opening folder dialog: %v", err)
+				dialog.ShowError(err, myWindow)
+				return
+			}
+			if uri != nil {
+				dbNameEntry.SetText(uri.Path())
+				log.Printf("Selected output folder: %s", uri.Path())
+			}
+		}, myWindow)
+	})
+	sinkFormatSelect := widget.NewSelect(sinkFormats, nil)
+	sinkFormatSelect.SetSelected(sinkFormats[0])
+	compressionSelect := widget.NewSelect(compressionLabels(), nil)
+	compressionSelect.SetSelected(compressionLabel(""))
+	rotateSizeEntry := widget.NewEntry()
+	rotateSizeEntry.SetPlaceHolder("New file after, e.g. 1GB (blank for never)")
+	sinkOptions := container.NewGridWithColumns(3, sinkFormatSelect, compressionSelect, rotateSizeEntry)
+
+	// updateForm shows the fields the chosen backend and login use.
+	var backendSelect *widget.Select
+	updateForm := func() {
+		backend := backendFromLabel(backendSelect.Selected)
+		auth := authSQL
+		if backend == "mssql" {
+			auth = authFromLabel(authSelect.Selected)
+		}
+		server := backend != "sqlite" && backend != "files"
+		password := server && authUsesPassword(auth)
+		showIf(server, serverEntry, portEntry)
+		showIf(backend == "mssql", authSelect)
+		showIf(server && authUsesUsername(auth), usernameEntry)
+		showIf(password, passwordEntry, passwordStoreSelect)
+		showIf(password && passwordStoreFromLabel(passwordStoreSelect.Selected) == passwordVault, masterPasswordEntry)
+		showIf(auth == authKerberos, kerberosOptions)
+		showIf(auth == authAzurePrincipal, tenantEntry)
+		encrypt := encryptFromLabel(encryptSelect.Selected)
+		showIf(backend == "mssql", encryptSelect)
+		showIf(backend == "mssql" && encrypt == encryptMandatory, trustCertCheck)
+		showIf(backend == "mssql" && (encrypt == encryptMandatory || encrypt == encryptStrict), certificateOptions)
+		showIf(backend == "postgres", sslModeSelect)
+		usernameHint, passwordHint := authHints(auth)
+		usernameEntry.SetPlaceHolder(usernameHint)
+		passwordEntry.SetPlaceHolder(passwordHint)
+
+		showIf(backend == "sqlite", dbFileButton)
+		showIf(backend == "files", outputDirButton, sinkOptions)
+		switch backend {
+		case "sqlite":
+			dbNameEntry.SetPlaceHolder("Database File (.db)")
+		case "files":
+			dbNameEntry.SetPlaceHolder("Output Folder")
+		default:
+			dbNameEntry.SetPlaceHolder("Database Name")
+		}
+		if backend == "postgres" {
+			portEntry.SetPlaceHolder("Port (default 5432)")
+		} else {
+			portEntry.SetPlaceHolder("Port (default 1433)")
+		}
+	}
+	backendSelect = widget.NewSelect(backendLabels(), func(string) { updateForm() })
+	authSelect.OnChanged = func(string) { updateForm() }
+	passwordStoreSelect.OnChanged = func(string) { updateForm() }
+	encryptSelect.OnChanged = func(string) { updateForm() }
+	authSelect.SetSelected(authLabel(authSQL))
+	encryptSelect.SetSelected(encryptLabel(encryptDefault))
+
+	// formConfig reads the connection settings from the form.
+	formConfig := func() (ConnectionConfig, error) {
+		cfg := ConnectionConfig{
+			Backend:     backendFromLabel(backendSelect.Selected),
+			Server:      serverEntry.Text,
+			Port:        portEntry.Text,
+			Username:    usernameEntry.Text,
+			Password:    passwordEntry.Text,
+			Database:    dbNameEntry.Text,
+			FileFormat:  sinkFormatSelect.Selected,
+			Compression: compressionFromLabel(compressionSelect.Selected),
+		}
+		if cfg.Backend == "mssql" {
+			cfg.Auth = authFromLabel(authSelect.Selected)
+			cfg.Realm = realmEntry.Text
+			cfg.Krb5Config = krb5ConfigEntry.Text
+			cfg.Keytab = keytabEntry.Text
+			cfg.TenantID = tenantEntry.Text
+			if !authUsesUsername(cfg.Auth) {
+				cfg.Username = ""
+			}
+			if !authUsesPassword(cfg.Auth) {
+				cfg.Password = ""
+			}
+			cfg.Encrypt = encryptFromLabel(encryptSelect.Selected)
+			if cfg.Encrypt == encryptMandatory || cfg.Encrypt == encryptStrict {
+				cfg.TrustServerCert = trustCertCheck.Checked && cfg.Encrypt == encryptMandatory
+				cfg.TLSCA = tlsCAEntry.Text
+				cfg.TLSHostname = tlsHostnameEntry.Text
+				cfg.TLSPin = tlsPinEntry.Text
+			}
+		}
+		if cfg.Backend == "postgres" {
+			cfg.SSLMode = sslModeFromLabel(sslModeSelect.Selected)
+		}
+		rotateSize, err := parseSize(rotateSizeEntry.Text)
+		if err != nil {
+			return cfg, fmt.Errorf("rotation size: %v", err)
+		}
+		cfg.RotateSize = rotateSize
+		return cfg, nil
+	}
+
+	// saveProfile saves cfg as the named profile, keeping the password as
+	// chosen on the form. SQLite, file output and logins without a password
+	// have none to keep.
+	saveProfile := func(name string, cfg ConnectionConfig) error {
+		passwordStore := passwordStoreFromLabel(passwordStoreSelect.Selected)
+		if cfg.Backend == "sqlite" || cfg.Backend == "files" || !authUsesPassword(cfg.Auth) {
+			passwordStore = passwordNone
+		}
+		return saveCredentials(name, cfg, passwordStore, masterPasswordEntry.Text)
+	}
+
+	// loadProfile fills the form from a saved profile, asking for the master
+	// password if the profile's password is encrypted with one.
+	loadProfile := func(name string) {
+		credentials, passwordStore, err := loadCredentials(name, "")
+		if err != nil {
+			log.Printf("Error loading credentials: %v", err)
+			dialog.ShowError(err, myWindow)
+			return
+		}
+		if passwordStore == "" {
+			passwordStore = passwordKeyring
+		}
+		passwordStoreSelect.SetSelected(passwordStoreLabel(passwordStore))
+		masterPasswordEntry.SetText("")
+		backendSelect.SetSelected(backendLabel(credentials.Backend))
+		serverEntry.SetText(credentials.Server)
+		portEntry.SetText(credentials.Port)
+		usernameEntry.SetText(credentials.Username)
+		passwordEntry.SetText(credentials.Password)
+		dbNameEntry.SetText(credentials.Database)
+		authSelect.SetSelected(authLabel(credentials.Auth))
+		realmEntry.SetText(credentials.Realm)
+		krb5ConfigEntry.SetText(credentials.Krb5Config)
+		keytabEntry.SetText(credentials.Keytab)
+		tenantEntry.SetText(credentials.TenantID)
+		encryptSelect.SetSelected(encryptLabel(credentials.Encrypt))
+		trustCertCheck.SetChecked(credentials.TrustServerCert)
+		tlsCAEntry.SetText(credentials.TLSCA)
+		tlsHostnameEntry.SetText(credentials.TLSHostname)
+		tlsPinEntry.SetText(credentials.TLSPin)
+		sslModeSelect.SetSelected(sslModeLabel(credentials.SSLMode))
+		if passwordStore == passwordVault {
+			unlockEntry := widget.NewPasswordEntry()
+			items := []*widget.FormItem{widget.NewFormItem("Master Password", unlockEntry)}
+			dialog.ShowForm("Unlock Saved Password", "Unlock", "Skip", items, func(confirmed bool) {
+				if !confirmed {
+					return
+				}
+				saved, _, err := loadCredentials(name, unlockEntry.Text)
+				if err != nil {
+					log.Printf("Error unlocking saved password: %v", err)
+					dialog.ShowError(err, myWindow)
+					return
+				}
+				passwordEntry.SetText(saved.Password)
+				masterPasswordEntry.SetText(unlockEntry.Text)
+			}, myWindow)
+		}
+		sinkFormatSelect.SetSelected(sinkFormats[0])
+		if credentials.FileFormat != "" {
+			sinkFormatSelect.SetSelected(credentials.FileFormat)
+		}
+		compressionSelect.SetSelected(compressionLabel(credentials.Compression))
+		rotateSizeEntry.SetText(formatSize(credentials.RotateSize))
+	}
+
+	profilePicker, profileBar, refreshProfiles := newProfilePicker(myWindow, loadProfile, func(name string) error {
+		cfg, err := formConfig()
+		if err != nil {
+			return err
+		}
+		return saveProfile(name, cfg)
+	})
+	backendSelect.SetSelected(backendLabel(defaultBackend))
+	if _, current, err := listProfiles(); err != nil {
+		log.Printf("Error loading credentials: %v", err)
+		dialog.ShowError(err, myWindow)
+	} else {
+		refreshProfiles(current)
+		if current != "" {
+			loadProfile(current)
+		}
+	}
+
+	statusLabel := widget.NewLabel("Status: Not connected")
+	progressLabel := widget.NewLabel("Progress: Not started")
+
+	connectButton := widget.NewButton("Connect", nil)
+	createTableButton := widget.NewButton("Create New Table", nil)
+	selectTableButton := widget.NewButton("Select Existing Table", nil)
+	exportButton := widget.NewButton("Export Table", nil)
+
+	folderEntry := widget.NewEntry()
+	folderEntry.SetPlaceHolder("Enter or select folder path to scan")
+	browseButton := widget.NewButton("Browse", func() {
+		dialog.ShowFolderOpen(func(uri fyne.ListableURI, err error) {
+			if err != nil {
+				log.Printf("Error opening folder dialog: %v", err)
+				dialog.ShowError(err, myWindow)
+				return
+			}
+			if uri != nil {
+				folderEntry.SetText(uri.Path())
+				log.Printf("Selected folder path: %s", uri.Path())
+			}
+		}, myWindow)
+	})
+
+	manualPathButton := widget.NewButton("Enter UNC Path", func() {
+		entry := widget.NewEntry()
+		entry.SetPlaceHolder("Enter UNC path (e.g., \\\\server\\share)")
+		dialog.ShowCustomConfirm("Enter UNC Path", "OK", "Cancel", entry, func(b bool) {
+			if b {
+				folderEntry.SetText(entry.Text)
+				log.Printf("Manually entered folder path: %s", entry.Text)
+			}
+		}, myWindow)
+	})
+
+	hashSelect := widget.NewSelect(hashChoiceLabels(), nil)
+	hashSelect.SetSelected(hashChoices[0].label)
+	hashRateEntry := widget.NewEntry()
+	hashRateEntry.SetPlaceHolder("Hash read limit in MB/s (blank for unlimited)")
+	incrementalCheck := widget.NewCheck("Incremental (only write new or changed files)", nil)
+	purgeDeletedCheck := widget.NewCheck("Remove rows of deleted files instead of marking them", nil)
+	extractCheck := widget.NewCheck("Extract document, image and audio metadata", nil)
+	mimeCheck := widget.NewCheck("Detect file types from content and flag extension mismatches", nil)
+	watchCheck := widget.NewCheck("Keep watching for changes after the scan", nil)
+	filters := newFilterForm()
+
+	scanOptionsFromForm := func() (ScanOptions, error) {
+		opts := ScanOptions{
+			HashAlgorithm:  hashFromLabel(hashSelect.Selected),
+			Incremental:    incrementalCheck.Checked,
+			PurgeDeleted:   purgeDeletedCheck.Checked,
+			ExtractContent: extractCheck.Checked,
+			DetectMIME:     mimeCheck.Checked,
+		}
+		if rate := strings.TrimSpace(hashRateEntry.Text); rate != "" {
+			mb, err := strconv.ParseFloat(rate, 64)
+			if err != nil || mb < 0 {
+				return opts, fmt.Errorf("invalid hash read limit %q", rate)
+			}
+			opts.HashRateLimit = int64(mb * 1024 * 1024)
+		}
+		rules, err := filters.rules()
+		if err != nil {
+			return opts, fmt.Errorf("invalid filter: %v", err)
+		}
+		opts.Filters = rules
+		return opts, nil
+	}
+	setScanOptionsForm := func(opts ScanOptions) {
+		hashSelect.SetSelected(hashLabel(opts.HashAlgorithm))
+		incrementalCheck.SetChecked(opts.Incremental)
+		purgeDeletedCheck.SetChecked(opts.PurgeDeleted)
+		extractCheck.SetChecked(opts.ExtractContent)
+		mimeCheck.SetChecked(opts.DetectMIME)
+		hashRateEntry.SetText("")
+		if opts.HashRateLimit > 0 {
+			hashRateEntry.SetText(strconv.FormatFloat(float64(opts.HashRateLimit)/(1024*1024), 'f', -1, 64))
+		}
+		filters.set(opts.Filters)
+	}
+	if profile, err := loadScanProfile(); err != nil {
+		log.Printf("Error loading scan profile: %v", err)
+	} else {
+		setScanOptionsForm(profile)
+	}
+
+	startButton := widget.NewButton("Start Scan", nil)
+	pauseButton := widget.NewButton("Pause Scan", nil)
+	resumeButton := widget.NewButton("Resume Scan", nil)
+	stopButton := widget.NewButton("Stop Scan", nil)
+
+	createTableButton.Disable()
+	selectTableButton.Disable()
+	exportButton.Disable()
+	startButton.Disable()
+	pauseButton.Disable()
+	resumeButton.Disable()
+	stopButton.Disable()
+
+	var store Storage
+	var tableName string
+
+	connectButton.OnTapped = func() {
+		cfg, err := formConfig()
+		if err != nil {
+			statusLabel.SetText(fmt.Sprintf("Error: %v", err))
+			return
+		}
+
+		if store != nil {
+			store.Close()
+		}
+		store, err = openStorage(cfg)
+		if err != nil {
+			log.Printf("Error connecting to database: %v", err)
+			statusLabel.SetText(fmt.Sprintf("Error: %v", err))
+			return
+		}
+
+		// The connection is saved to the picked profile, or to the default
+		// one when none is picked.
+		profile := profilePicker.Selected
+		if profile == "" {
+			profile = defaultProfile
+		}
+		if err := saveProfile(profile, cfg); err != nil {
+			log.Printf("Error saving credentials: %v", err)
+			dialog.ShowError(err, myWindow)
+		} else if profilePicker.Selected == "" {
+			refreshProfiles(profile)
+		}
+
+		log.Println("Database connected successfully")
+		statusLabel.SetText("Status: Connected successfully")
+		createTableButton.Enable()
+		selectTableButton.Enable()
+	}
+
+	createTableButton.OnTapped = func() {
+		entry := widget.NewEntry()
+		entry.SetPlaceHolder("Enter New Table Name, e.g. files or inventory.files")
+		dialog.ShowCustomConfirm("Create New Table", "Create", "Cancel", entry, func(b bool) {
+			if b {
+				err := store.CreateCatalog(entry.Text)
+				if err != nil {
+					log.Printf("Error creating table: %v", err)
+					statusLabel.SetText(fmt.Sprintf("Error creating table: %v", err))
+					return
+				}
+				tableName = entry.Text
+				log.Printf("Table '%s' created successfully", tableName)
+				statusLabel.SetText(fmt.Sprintf("Table '%s' created successfully", tableName))
+				startButton.Enable()
+				exportButton.Enable()
+			}
+		}, myWindow)
+	}
+
+	selectTableButton.OnTapped = func() {
+		tables, err := store.ListCatalogs()
+		if err != nil {
+			log.Printf("Error getting tables: %v", err)
+			statusLabel.SetText(fmt.Sprintf("Error getting tables: %v", err))
+			return
+		}
+		if len(tables) == 0 {
+			log.Println("No existing tables found")
+			statusLabel.SetText("No existing tables found")
+			return
+		}
+
+		tableSelect := widget.NewSelect(tables, func(value string) {
+			tableName = value
+		})
+		dialog.ShowCustomConfirm("Select Table", "Select", "Cancel", tableSelect, func(b bool) {
+			if b && tableName != "" {
+				log.Printf("Table '%s' selected", tableName)
+				statusLabel.SetText(fmt.Sprintf("Table '%s' selected", tableName))
+				startButton.Enable()
+				exportButton.Enable()
+			}
+		}, myWindow)
+	}
+
+	exportButton.OnTapped = func() {
+		showExportDialog(myWindow, store, tableName, strings.TrimSpace(folderEntry.Text), filters, statusLabel)
+	}
+
+	startButton.OnTapped = func() {
+		folderPath := strings.TrimSpace(folderEntry.Text)
+		if folderPath == "" {
+			log.Println("Error: No folder path provided")
+			statusLabel.SetText("Error: Please enter or select a folder path to scan")
+			return
+		}
+
+		if _, err := os.Stat(folderPath); os.IsNotExist(err) {
+			log.Printf("Error: Folder path does not exist: %s", folderPath)
+			statusLabel.SetText(fmt.Sprintf("Error: Folder path does not exist: %s", folderPath))
+			return
+		}
+
+		opts, err := scanOptionsFromForm()
+		if err != nil {
+			log.Printf("Error: %v", err)
+			statusLabel.SetText(fmt.Sprintf("Error: %v", err))
+			return
+		}
+		if err := saveScanProfile(opts); err != nil {
+			log.Printf("Error saving scan profile: %v", err)
+		}
+
+		scanning = true
+		paused = false
+		startButton.Disable()
+		pauseButton.Enable()
+		stopButton.Enable()
+		statusLabel.SetText("Status: Scanning")
+
+		if err := loadScanState(); err != nil {
+			log.Printf("Error loading scan state: %v", err)
+			dialog.ShowError(fmt.Errorf("Error loading scan state: %v", err), myWindow)
+		}
+
+		scanState.FolderPath = folderPath
+		scanState.TableName = tableName
+		scanState.Options = opts
+		if scanState.FilesScanned == nil {
+			scanState.FilesScanned = make(map[string]bool)
+		}
+
+		var ctx context.Context
+		ctx, cancelFunc = context.WithCancel(context.Background())
+		scanDone = make(chan struct{})
+
+		go func() {
+			defer close(scanDone)
+			log.Printf("Starting scan of folder: %s", folderPath)
+			var err error
+			watch := watchCheck.Checked
+			if watch {
+				err = watchFolder(ctx, store, tableName, folderPath, opts)
+			} else {
+				err = scanFolder(ctx, store, tableName, folderPath, opts)
+			}
+			if err != nil {
+				if err == context.Canceled {
+					log.Println("Scan stopped")
+					statusLabel.SetText("Status: Scan stopped")
+				} else {
+					log.Printf("Error during scan: %v", err)
+					statusLabel.SetText(fmt.Sprintf("Error during scan: %v", err))
+				}
+			} else if watch {
+				statusLabel.SetText("Status: Stopped watching")
+			} else {
+				log.Println("Scan completed successfully")
+				status := "Status: Scan completed successfully"
+				if files, bytes := GetDeletionStats(); files > 0 {
+					action := "marked"
+					if opts.PurgeDeleted {
+						action = "removed"
+					}
+					status += fmt.Sprintf(", %s %d deleted files (%s)", action, files, formatBytes(bytes))
+				}
+				statusLabel.SetText(status)
+			}
+			scanStateLock.Lock()
+			if err := saveScanState(); err != nil {
+				log.Printf("Error saving scan state: %v", err)
+				dialog.ShowError(fmt.Errorf("Error saving scan state: %v", err), myWindow)
+			}
+			scanStateLock.Unlock()
+			scanning = false
+			startButton.Enable()
+			pauseButton.Disable()
+			resumeButton.Disable()
+			stopButton.Disable()
+			if err := deleteScanState(); err != nil {
+				log.Printf("Error deleting scan state: %v", err)
+				dialog.ShowError(fmt.Errorf("Error deleting scan state: %v", err), myWindow)
+			}
+			// Start a fresh state for the next scan; otherwise it would skip
+			// every file this one recorded as scanned.
+			scanStateLock.Lock()
+			scanState = ScanState{}
+			scanStateLock.Unlock()
+		}()
+
+		ticker := time.NewTicker(100 * time.Millisecond)
+		go func() {
+			for {
+				select {
+				case <-ticker.C:
+					if !scanning {
+						ticker.Stop()
+						return
+					}
+					filesScanned, filesWritten, scanSpeed, writeSpeed := GetProgressStats()
+					progressText := fmt.Sprintf("Progress: Scanned %d files, Written %d files\nScan speed: %.2f files/sec, Write speed: %.2f files/sec",
+						filesScanned, filesWritten, scanSpeed, writeSpeed)
+					if opts.Incremental {
+						newFiles, changedFiles, unchangedFiles := GetChangeStats()
+						progressText += fmt.Sprintf("\nNew: %d, Changed: %d, Unchanged: %d", newFiles, changedFiles, unchangedFiles)
+					}
+					if IsWatching() {
+						statusLabel.SetText("Status: Watching for changes")
+					}
+					log.Println(progressText)
+					progressLabel.SetText(progressText)
+					myWindow.Canvas().Refresh(progressLabel)
+				case <-scanDone:
+					ticker.Stop()
+					return
+				}
+			}
+		}()
+	}
+
+	pauseButton.OnTapped = func() {
+		paused = true
+		pauseButton.Disable()
+		resumeButton.Enable()
+		log.Println("Scan paused")
+		statusLabel.SetText("Status: Paused")
+	}
+
+	resumeButton.OnTapped = func() {
+		paused = false
+		pauseButton.Enable()
+		resumeButton.Disable()
+		log.Println("Scan resumed")
+		statusLabel.SetText("Status: Scanning")
+	}
+
+	stopButton.OnTapped = func() {
+		if cancelFunc != nil {
+			cancelFunc()
+		}
+		log.Println("Stopping scan...")
+		statusLabel.SetText("Status: Stopping scan...")
+		go func() {
+			<-scanDone
+			scanning = false
+			paused = false
+			startButton.Enable()
+			pauseButton.Disable()
+			resumeButton.Disable()
+			stopButton.Disable()
+			log.Println("Scan stopped")
+			statusLabel.SetText("Status: Scan stopped")
+			myWindow.Content().Refresh()
+		}()
+	}
+
+	exists, err := scanStateExists()
+	if err != nil {
+		log.Printf("Error checking scan state: %v", err)
+		dialog.ShowError(fmt.Errorf("Error checking scan state: %v", err), myWindow)
+	} else if exists {
+		dialog.ShowConfirm("Resume Scan", "A previous scan was not completed. Do you want to resume?", func(b bool) {
+			if b {
+				if err := loadScanState(); err != nil {
+					log.Printf("Error loading scan state: %v", err)
+					dialog.ShowError(fmt.Errorf("Error loading scan state: %v", err), myWindow)
+				} else {
+					folderEntry.SetText(scanState.FolderPath)
+					setScanOptionsForm(scanState.Options)
+					startButton.Enable()
+				}
+			} else {
+				if err := deleteScanState(); err != nil {
+					log.Printf("Error deleting scan state: %v", err)
+					dialog.ShowError(fmt.Errorf("Error deleting scan state: %v", err), myWindow)
+				}
+			}
+		}, myWindow)
+	}
+
+	topForm := container.NewVBox(
+		widget.NewLabel("Connect to Database"),
+		profileBar,
+		backendSelect,
+		serverEntry,
+		portEntry,
+		authSelect,
+		usernameEntry,
+		passwordEntry,
+		passwordStoreSelect,
+		masterPasswordEntry,
+		kerberosOptions,
+		tenantEntry,
+		encryptSelect,
+		trustCertCheck,
+		certificateOptions,
+		sslModeSelect,
+		dbNameEntry,
+		dbFileButton,
+		outputDirButton,
+		sinkOptions,
+		connectButton,
+		createTableButton,
+		selectTableButton,
+		exportButton,
+	)
+
+	middleForm := container.NewHBox(
+		folderEntry,
+		browseButton,
+		manualPathButton,
+	)
+
+	bottomForm := container.NewHBox(
+		startButton,
+		pauseButton,
+		resumeButton,
+		stopButton,
+	)
+
+	content := container.NewVBox(
+		topForm,
+		widget.NewSeparator(),
+		widget.NewLabel("Enter or Select Folder to Scan"),
+		middleForm,
+		container.NewGridWithColumns(2, hashSelect, hashRateEntry),
+		incrementalCheck,
+		purgeDeletedCheck,
+		extractCheck,
+		mimeCheck,
+		watchCheck,
+		filters.object(),
+		widget.NewSeparator(),
+		bottomForm,
+		statusLabel,
+		progressLabel,
+	)
+
+	tabs := container.NewAppTabs(
+		container.NewTabItem("Scan", content),
+		container.NewTabItem("Duplicates", newDuplicatesTab(myWindow,
+			func() Storage { return store },
+			func() string { return tableName })),
+		container.NewTabItem("Browse", newBrowseTab(myWindow,
+			func() Storage { return store },
+			func() string { return tableName })),
+		container.NewTabItem("Usage", newUsageTab(
+			func() Storage { return store },
+			func() string { return tableName },
+			func() string { return strings.TrimSpace(folderEntry.Text) })),
+	)
+
+	myWindow.SetContent(tabs)
+	myWindow.Resize(fyne.NewSize(800, 650))
+	myWindow.ShowAndRun()
+}
+
+// backendChoices lists the storage backends offered in the connection form,
+// in display order, with their labels.
+var backendChoices = []struct {
+	backend, label string
+}{
+	{"mssql", "SQL Server"},
+	{"sqlite", "SQLite (local file)"},
+	{"postgres", "PostgreSQL"},
+	{"files", "Files (CSV or NDJSON, no database)"},
+}
+
+func backendLabels() []string {
+	labels := make([]string, 0, len(backendChoices))
+	for _, choice := range backendChoices {
+		labels = append(labels, choice.label)
+	}
+	return labels
+}
+
+func backendLabel(backend string) string {
+	if backend == "" {
+		backend = defaultBackend
+	}
+	for _, choice := range backendChoices {
+		if choice.backend == backend {
+			return choice.label
+		}
+	}
+	return backendChoices[0].label
+}
+
+func backendFromLabel(label string) string {
+	for _, choice := range backendChoices {
+		if choice.label == label {
+			return choice.backend
+		}
+	}
+	return defaultBackend
+}
+
+// authChoices are the SQL Server login modes, with the hints shown in the
+// user name and password entries.
+var authChoices = []struct {
+	auth, label, username, password string
+}{
+	{authSQL, "SQL Server login", "Username", "Password"},
+	{authIntegrated, "Windows integrated (current user)", "", ""},
+	{authKerberos, "Kerberos (keytab or password)", "Principal, e.g. svc_scanner", "Password (blank to use the keytab)"},
+	{authAzurePrincipal, "Azure AD service principal", "Application (Client) ID", "Client Secret"},
+	{authAzureMSI, "Azure managed identity", "Client ID (blank for the system identity)", ""},
+	{authAzureDefault, "Azure AD default credentials", "", ""},
+}
+
+func authLabels() []string {
+	labels := make([]string, 0, len(authChoices))
+	for _, choice := range authChoices {
+		labels = append(labels, choice.label)
+	}
+	return labels
+}
+
+func authLabel(auth string) string {
+	for _, choice := range authChoices {
+		if choice.auth == auth {
+			return choice.label
+		}
+	}
+	return authChoices[0].label
+}
+
+func authFromLabel(label string) string {
+	for _, choice := range authChoices {
+		if choice.label == label {
+			return choice.auth
+		}
+	}
+	return authSQL
+}
+
+// authHints returns the placeholders of the user name and password entries
+// for a login mode.
+func authHints(auth string) (string, string) {
+	for _, choice := range authChoices {
+		if choice.auth == auth {
+			return choice.username, choice.password
+		}
+	}
+	return authChoices[0].username, authChoices[0].password
+}
+
+// encryptChoices are the SQL Server encryption modes.
+var encryptChoices = []struct {
+	encrypt, label string
+}{
+	{encryptDefault, "Encrypt the login only"},
+	{encryptMandatory, "Encrypt all traffic"},
+	{encryptStrict, "Encrypt all traffic, strict (TDS 8.0)"},
+	{encryptDisable, "Don't encrypt"},
+}
+
+func encryptLabels() []string {
+	labels := make([]string, 0, len(encryptChoices))
+	for _, choice := range encryptChoices {
+		labels = append(labels, choice.label)
+	}
+	return labels
+}
+
+func encryptLabel(encrypt string) string {
+	for _, choice := range encryptChoices {
+		if choice.encrypt == encrypt {
+			return choice.label
+		}
+	}
+	return encryptChoices[0].label
+}
+
+func encryptFromLabel(label string) string {
+	for _, choice := range encryptChoices {
+		if choice.label == label {
+			return choice.encrypt
+		}
+	}
+	return encryptDefault
+}
+
+// sslModeChoices are the PostgreSQL TLS modes.
+var sslModeChoices = []struct {
+	sslMode, label string
+}{
+	{sslRequire, "Encrypt without checking the certificate"},
+	{sslVerifyCA, "Encrypt and check the certificate's CA"},
+	{sslVerifyFull, "Encrypt and check the certificate's CA and host name"},
+	{sslDisable, "Don't encrypt"},
+}
+
+func sslModeLabels() []string {
+	labels := make([]string, 0, len(sslModeChoices))
+	for _, choice := range sslModeChoices {
+		labels = append(labels, choice.label)
+	}
+	return labels
+}
+
+func sslModeLabel(sslMode string) string {
+	for _, choice := range sslModeChoices {
+		if choice.sslMode == sslMode {
+			return choice.label
+		}
+	}
+	return sslModeChoices[0].label
+}
+
+func sslModeFromLabel(label string) string {
+	for _, choice := range sslModeChoices {
+		if choice.label == label {
+			return choice.sslMode
+		}
+	}
+	return sslRequire
+}
+
+// showIf shows objects when visible is true and hides them otherwise.
+func showIf(visible bool, objects ...fyne.CanvasObject) {
+	for _, object := range objects {
+		if visible {
+			object.Show()
+		} else {
+			object.Hide()
+		}
+	}
+}
+
+// passwordStoreChoices are the ways the saved connection can keep the
+// password.
+var passwordStoreChoices = []struct {
+	store, label string
+}{
+	{passwordKeyring, "Remember password in the system keyring"},
+	{passwordVault, "Remember password encrypted with a master password"},
+	{passwordNone, "Don't remember password"},
+}
+
+func passwordStoreLabels() []string {
+	labels := make([]string, 0, len(passwordStoreChoices))
+	for _, choice := range passwordStoreChoices {
+		labels = append(labels, choice.label)
+	}
+	return labels
+}
+
+func passwordStoreLabel(store string) string {
+	for _, choice := range passwordStoreChoices {
+		if choice.store == store {
+			return choice.label
+		}
+	}
+	return passwordStoreChoices[0].label
+}
+
+func passwordStoreFromLabel(label string) string {
+	for _, choice := range passwordStoreChoices {
+		if choice.label == label {
+			return choice.store
+		}
+	}
+	return passwordKeyring
+}
+
+// compressionChoices are the compression options of the files backend.
+var compressionChoices = []struct {
+	compression, label string
+}{
+	{"", "No compression"},
+	{"gzip", "gzip"},
+	{"zstd", "zstd"},
+}
+
+func compressionLabels() []string {
+	labels := make([]string, 0, len(compressionChoices))
+	for _, choice := range compressionChoices {
+		labels = append(labels, choice.label)
+	}
+	return labels
+}
+
+func compressionLabel(compression string) string {
+	for _, choice := range compressionChoices {
+		if choice.compression == compression {
+			return choice.label
+		}
+	}
+	return compressionChoices[0].label
+}
+
+func compressionFromLabel(label string) string {
+	for _, choice := range compressionChoices {
+		if choice.label == label {
+			return choice.compression
+		}
+	}
+	return ""
+}
+
+// hashChoices are the content hash options offered on the scan form.
+var hashChoices = []struct {
+	algorithm, label string
+}{
+	{hashNone, "No content hash"},
+	{hashSHA256, "SHA-256"},
+	{hashXXHash, "xxHash (fastest)"},
+	{hashBLAKE3, "BLAKE3"},
+}
+
+func hashChoiceLabels() []string {
+	labels := make([]string, 0, len(hashChoices))
+	for _, choice := range hashChoices {
+		labels = append(labels, choice.label)
+	}
+	return labels
+}
+
+func hashLabel(algorithm string) string {
+	for _, choice := range hashChoices {
+		if choice.algorithm == algorithm {
+			return choice.label
+		}
+	}
+	return hashChoices[0].label
+}
+
+func hashFromLabel(label string) string {
+	for _, choice := range hashChoices {
+		if choice.label == label {
+			return choice.algorithm
+		}
+	}
+	return hashNone
+}
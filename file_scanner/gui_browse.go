@@ -0,0 +1,216 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// newBrowseTab builds the catalog browser: a search form over the selected
+// table and a paged table of the matching files, from which a file's folder
+// can be opened or its path copied.
+func newBrowseTab(myWindow fyne.Window, getStore func() Storage, getTable func() string) fyne.CanvasObject {
+	var files []FileInfo
+	var query FileQuery
+	var total int64
+	selected := -1
+
+	entry := func(placeHolder string) *widget.Entry {
+		e := widget.NewEntry()
+		e.SetPlaceHolder(placeHolder)
+		return e
+	}
+	nameEntry := entry("Part of the file name")
+	extensionEntry := entry("e.g. pdf")
+	minSizeEntry := entry("e.g. 10KB")
+	maxSizeEntry := entry("e.g. 2GB")
+	afterEntry := entry("YYYY-MM-DD")
+	beforeEntry := entry("YYYY-MM-DD")
+	summaryLabel := widget.NewLabel("Select a table on the Scan tab, then search it")
+	pathLabel := widget.NewLabel("")
+
+	headers := []string{"Name", "Folder", "Size", "Modified"}
+	table := widget.NewTable(
+		func() (int, int) { return len(files) + 1, len(headers) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.TableCellID, cell fyne.CanvasObject) {
+			label := cell.(*widget.Label)
+			if id.Row == 0 {
+				label.SetText(headers[id.Col])
+				return
+			}
+			file := files[id.Row-1]
+			switch id.Col {
+			case 0:
+				label.SetText(file.FileName)
+			case 1:
+				label.SetText(filepath.Dir(file.FilePath))
+			case 2:
+				label.SetText(formatBytes(file.FileSize))
+			case 3:
+				label.SetText(file.ModTime.Format("2006-01-02 15:04"))
+			}
+		})
+	table.SetColumnWidth(0, 220)
+	table.SetColumnWidth(1, 360)
+	table.SetColumnWidth(2, 90)
+	table.SetColumnWidth(3, 130)
+
+	var openButton, copyButton, prevButton, nextButton *widget.Button
+	table.OnSelected = func(id widget.TableCellID) {
+		if id.Row == 0 || id.Row > len(files) {
+			return
+		}
+		selected = id.Row - 1
+		pathLabel.SetText(files[selected].FilePath)
+		openButton.Enable()
+		copyButton.Enable()
+	}
+
+	// fetch loads a page of search results. query only changes once it has
+	// loaded, so paging continues from what is shown.
+	fetch := func(page FileQuery) {
+		reader, ok := getStore().(CatalogReader)
+		tableName := getTable()
+		if !ok || tableName == "" {
+			summaryLabel.SetText("Connect and select a table on the Scan tab first")
+			return
+		}
+		summaryLabel.SetText(fmt.Sprintf("Searching '%s'...", tableName))
+		go func() {
+			found, count, err := reader.SearchFiles(tableName, page)
+			if err != nil {
+				log.Printf("Error searching files: %v", err)
+				summaryLabel.SetText(fmt.Sprintf("Error searching files: %v", err))
+				return
+			}
+			files, total, query = found, count, page
+			selected = -1
+			pathLabel.SetText("")
+			openButton.Disable()
+			copyButton.Disable()
+			if total == 0 {
+				summaryLabel.SetText("No matching files")
+			} else {
+				summaryLabel.SetText(fmt.Sprintf("Files %d to %d of %d", query.Offset+1, query.Offset+len(files), total))
+			}
+			if query.Offset > 0 {
+				prevButton.Enable()
+			} else {
+				prevButton.Disable()
+			}
+			if int64(query.Offset+len(files)) < total {
+				nextButton.Enable()
+			} else {
+				nextButton.Disable()
+			}
+			table.UnselectAll()
+			table.Refresh()
+			table.ScrollToTop()
+		}()
+	}
+
+	searchButton := widget.NewButton("Search", func() {
+		q := FileQuery{
+			NameContains: strings.TrimSpace(nameEntry.Text),
+			Extension:    strings.TrimSpace(extensionEntry.Text),
+			Limit:        defaultPageSize,
+		}
+		var err error
+		if q.MinSize, err = parseSize(minSizeEntry.Text); err == nil {
+			if q.MaxSize, err = parseSize(maxSizeEntry.Text); err == nil {
+				if q.ModifiedAfter, err = parseDate(afterEntry.Text); err == nil {
+					q.ModifiedBefore, err = parseDate(beforeEntry.Text)
+				}
+			}
+		}
+		if err == nil {
+			err = q.validate()
+		}
+		if err != nil {
+			dialog.ShowError(err, myWindow)
+			return
+		}
+		fetch(q)
+	})
+	prevButton = widget.NewButton("Previous", func() {
+		page := query
+		page.Offset -= page.Limit
+		if page.Offset < 0 {
+			page.Offset = 0
+		}
+		fetch(page)
+	})
+	nextButton = widget.NewButton("Next", func() {
+		page := query
+		page.Offset += page.Limit
+		fetch(page)
+	})
+	prevButton.Disable()
+	nextButton.Disable()
+
+	openButton = widget.NewButton("Open Folder", func() {
+		if selected < 0 {
+			return
+		}
+		if err := openContainingFolder(files[selected].FilePath); err != nil {
+			log.Printf("Error opening folder: %v", err)
+			dialog.ShowError(err, myWindow)
+		}
+	})
+	copyButton = widget.NewButton("Copy Path", func() {
+		if selected < 0 {
+			return
+		}
+		myWindow.Clipboard().SetContent(files[selected].FilePath)
+	})
+	openButton.Disable()
+	copyButton.Disable()
+
+	form := container.NewGridWithColumns(4,
+		widget.NewLabel("Name contains"), nameEntry,
+		widget.NewLabel("Extension"), extensionEntry,
+		widget.NewLabel("Min size"), minSizeEntry,
+		widget.NewLabel("Max size"), maxSizeEntry,
+		widget.NewLabel("Modified after"), afterEntry,
+		widget.NewLabel("Modified before"), beforeEntry,
+	)
+	controls := container.NewVBox(
+		form,
+		container.NewHBox(searchButton, prevButton, nextButton),
+		summaryLabel,
+	)
+	actions := container.NewBorder(nil, nil, nil, container.NewHBox(openButton, copyButton), pathLabel)
+	return container.NewBorder(controls, actions, nil, nil, table)
+}
+
+// openContainingFolder shows the folder holding path in the system file
+// manager, with the file selected where the file manager supports it.
+func openContainingFolder(path string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("explorer", "/select,"+path)
+	case "darwin":
+		cmd = exec.Command("open", "-R", path)
+	default:
+		cmd = exec.Command("xdg-open", filepath.Dir(path))
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error opening folder: %v", err)
+	}
+	// Explorer exits with a failure status even when it succeeds, so only
+	// starting the command is checked.
+	go cmd.Wait()
+	return nil
+}
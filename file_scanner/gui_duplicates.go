@@ -0,0 +1,124 @@
+//go:build !headless
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// newDuplicatesTab builds the duplicate finder tab. It reads the current
+// store and table through the getters because both change after the tab is
+// created.
+func newDuplicatesTab(myWindow fyne.Window, getStore func() Storage, getTable func() string) fyne.CanvasObject {
+	var groups []DuplicateGroup
+
+	hashSelect := widget.NewSelect(hashChoiceLabels()[1:], nil)
+	hashSelect.SetSelected(hashLabel(defaultDuplicateHash))
+	summaryLabel := widget.NewLabel("Select a table on the Scan tab, then find duplicates")
+	pathsEntry := widget.NewMultiLineEntry()
+	pathsEntry.SetPlaceHolder("Select a group to see its files")
+
+	headers := []string{"Wasted", "Size", "Copies", "Content Hash"}
+	table := widget.NewTable(
+		func() (int, int) { return len(groups) + 1, len(headers) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.TableCellID, cell fyne.CanvasObject) {
+			label := cell.(*widget.Label)
+			if id.Row == 0 {
+				label.SetText(headers[id.Col])
+				return
+			}
+			group := groups[id.Row-1]
+			switch id.Col {
+			case 0:
+				label.SetText(formatBytes(group.WastedBytes))
+			case 1:
+				label.SetText(formatBytes(group.FileSize))
+			case 2:
+				label.SetText(strconv.Itoa(len(group.Paths)))
+			case 3:
+				label.SetText(group.ContentHash)
+			}
+		})
+	table.SetColumnWidth(0, 100)
+	table.SetColumnWidth(1, 100)
+	table.SetColumnWidth(2, 70)
+	table.SetColumnWidth(3, 480)
+	table.OnSelected = func(id widget.TableCellID) {
+		if id.Row == 0 || id.Row > len(groups) {
+			return
+		}
+		pathsEntry.SetText(strings.Join(groups[id.Row-1].Paths, "\n"))
+	}
+
+	var findButton, csvButton, jsonButton *widget.Button
+	findButton = widget.NewButton("Find Duplicates", func() {
+		reader, ok := getStore().(CatalogReader)
+		tableName := getTable()
+		if !ok || tableName == "" {
+			summaryLabel.SetText("Connect and select a table on the Scan tab first")
+			return
+		}
+
+		findButton.Disable()
+		summaryLabel.SetText(fmt.Sprintf("Finding duplicates in '%s'...", tableName))
+		algorithm := hashFromLabel(hashSelect.Selected)
+		go func() {
+			defer findButton.Enable()
+			found, err := findDuplicates(context.Background(), reader, tableName, algorithm, nil)
+			if err != nil {
+				log.Printf("Error finding duplicates: %v", err)
+				summaryLabel.SetText(fmt.Sprintf("Error finding duplicates: %v", err))
+				return
+			}
+			groups = found
+			copies, wasted := duplicateTotals(groups)
+			summaryLabel.SetText(fmt.Sprintf("%d duplicate groups, %d redundant copies, %s wasted",
+				len(groups), copies, formatBytes(wasted)))
+			pathsEntry.SetText("")
+			table.Refresh()
+			csvButton.Enable()
+			jsonButton.Enable()
+		}()
+	})
+
+	export := func(format string) {
+		dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				log.Printf("Error opening file dialog: %v", err)
+				dialog.ShowError(err, myWindow)
+				return
+			}
+			if writer == nil {
+				return
+			}
+			defer writer.Close()
+			if err := writeDuplicates(writer, format, groups); err != nil {
+				log.Printf("Error exporting duplicates: %v", err)
+				dialog.ShowError(err, myWindow)
+				return
+			}
+			log.Printf("Exported duplicate report to %s", writer.URI().Path())
+		}, myWindow)
+	}
+	csvButton = widget.NewButton("Export CSV", func() { export("csv") })
+	jsonButton = widget.NewButton("Export JSON", func() { export("json") })
+	csvButton.Disable()
+	jsonButton.Disable()
+
+	controls := container.NewVBox(
+		container.NewHBox(hashSelect, findButton, csvButton, jsonButton),
+		summaryLabel,
+	)
+	return container.NewBorder(controls, nil, nil, nil,
+		container.NewVSplit(table, pathsEntry))
+}
@@ -0,0 +1,75 @@
+//go:build !headless
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// showExportDialog asks for an export format and whether to apply the scan
+// folder and filters, then for the file to write, and exports the table in
+// the background, reporting on statusLabel.
+func showExportDialog(myWindow fyne.Window, store Storage, tableName, folder string, filters *filterForm, statusLabel *widget.Label) {
+	reader, ok := store.(CatalogReader)
+	if !ok {
+		dialog.ShowInformation("Export Table", "Tables of this backend cannot be read back", myWindow)
+		return
+	}
+	if tableName == "" {
+		dialog.ShowInformation("Export Table", "Connect and select a table first", myWindow)
+		return
+	}
+
+	formatSelect := widget.NewSelect(exportFormats, nil)
+	formatSelect.SetSelected(exportFormats[0])
+	filterCheck := widget.NewCheck("Only the scan folder and files kept by the scan filters", nil)
+	items := []*widget.FormItem{
+		widget.NewFormItem("Format", formatSelect),
+		widget.NewFormItem("", filterCheck),
+	}
+	dialog.ShowForm(fmt.Sprintf("Export '%s'", tableName), "Export", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		format := formatSelect.Selected
+		var root string
+		var rules FilterRules
+		if filterCheck.Checked {
+			var err error
+			if rules, err = filters.rules(); err != nil {
+				dialog.ShowError(err, myWindow)
+				return
+			}
+			root = folder
+		}
+
+		dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				log.Printf("Error opening file dialog: %v", err)
+				dialog.ShowError(err, myWindow)
+				return
+			}
+			if writer == nil {
+				return
+			}
+			statusLabel.SetText(fmt.Sprintf("Exporting '%s'...", tableName))
+			go func() {
+				defer writer.Close()
+				rows, err := exportCatalog(context.Background(), reader, tableName, root, rules, writer, format)
+				if err != nil {
+					log.Printf("Error exporting table: %v", err)
+					statusLabel.SetText(fmt.Sprintf("Error exporting table: %v", err))
+					return
+				}
+				log.Printf("Exported %d rows from '%s' to %s", rows, tableName, writer.URI().Path())
+				statusLabel.SetText(fmt.Sprintf("Exported %d rows from '%s'", rows, tableName))
+			}()
+		}, myWindow)
+	}, myWindow)
+}
@@ -0,0 +1,93 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+)
+
+// filterForm edits FilterRules. Lists are typed comma-separated, sizes with
+// an optional unit and dates as YYYY-MM-DD.
+type filterForm struct {
+	include, exclude              *widget.Entry
+	extensions, excludeExtensions *widget.Entry
+	minSize, maxSize              *widget.Entry
+	modifiedAfter, modifiedBefore *widget.Entry
+	pruneDirs                     *widget.Entry
+}
+
+func newFilterForm() *filterForm {
+	entry := func(placeHolder string) *widget.Entry {
+		e := widget.NewEntry()
+		e.SetPlaceHolder(placeHolder)
+		return e
+	}
+	return &filterForm{
+		include:           entry("e.g. *.jpg, reports/*.pdf"),
+		exclude:           entry("e.g. *.tmp, ~$*"),
+		extensions:        entry("e.g. jpg, png (blank for all)"),
+		excludeExtensions: entry("e.g. bak, log"),
+		minSize:           entry("e.g. 10KB"),
+		maxSize:           entry("e.g. 2GB"),
+		modifiedAfter:     entry("YYYY-MM-DD"),
+		modifiedBefore:    entry("YYYY-MM-DD"),
+		pruneDirs:         entry("e.g. .git, $RECYCLE.BIN, node_modules"),
+	}
+}
+
+// object returns the form inside a collapsed accordion item, since most
+// scans need no filters.
+func (f *filterForm) object() fyne.CanvasObject {
+	form := widget.NewForm(
+		widget.NewFormItem("Include", f.include),
+		widget.NewFormItem("Exclude", f.exclude),
+		widget.NewFormItem("Only extensions", f.extensions),
+		widget.NewFormItem("Skip extensions", f.excludeExtensions),
+		widget.NewFormItem("Min size", f.minSize),
+		widget.NewFormItem("Max size", f.maxSize),
+		widget.NewFormItem("Modified after", f.modifiedAfter),
+		widget.NewFormItem("Modified before", f.modifiedBefore),
+		widget.NewFormItem("Skip directories", f.pruneDirs),
+	)
+	return widget.NewAccordion(widget.NewAccordionItem("Filters", form))
+}
+
+func (f *filterForm) rules() (FilterRules, error) {
+	rules := FilterRules{
+		Include:           splitList(f.include.Text),
+		Exclude:           splitList(f.exclude.Text),
+		Extensions:        splitList(f.extensions.Text),
+		ExcludeExtensions: splitList(f.excludeExtensions.Text),
+		PruneDirs:         splitList(f.pruneDirs.Text),
+	}
+	var err error
+	if rules.MinSize, err = parseSize(f.minSize.Text); err != nil {
+		return rules, fmt.Errorf("min size: %v", err)
+	}
+	if rules.MaxSize, err = parseSize(f.maxSize.Text); err != nil {
+		return rules, fmt.Errorf("max size: %v", err)
+	}
+	if rules.ModifiedAfter, err = parseDate(f.modifiedAfter.Text); err != nil {
+		return rules, fmt.Errorf("modified after: %v", err)
+	}
+	if rules.ModifiedBefore, err = parseDate(f.modifiedBefore.Text); err != nil {
+		return rules, fmt.Errorf("modified before: %v", err)
+	}
+	return rules, rules.validate()
+}
+
+func (f *filterForm) set(rules FilterRules) {
+	f.include.SetText(strings.Join(rules.Include, ", "))
+	f.exclude.SetText(strings.Join(rules.Exclude, ", "))
+	f.extensions.SetText(strings.Join(rules.Extensions, ", "))
+	f.excludeExtensions.SetText(strings.Join(rules.ExcludeExtensions, ", "))
+	f.minSize.SetText(formatSize(rules.MinSize))
+	f.maxSize.SetText(formatSize(rules.MaxSize))
+	f.modifiedAfter.SetText(formatDate(rules.ModifiedAfter))
+	f.modifiedBefore.SetText(formatDate(rules.ModifiedBefore))
+	f.pruneDirs.SetText(strings.Join(rules.PruneDirs, ", "))
+}
@@ -0,0 +1,16 @@
+//go:build headless
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runGUI is a stand-in for builds made with the headless tag, which leave out
+// Fyne so the scanner can run on servers without a display or OpenGL.
+func runGUI() {
+	fmt.Fprintln(os.Stderr, "This build has no GUI. Run with a subcommand instead:")
+	printUsage(os.Stderr)
+	os.Exit(exitUsage)
+}
@@ -0,0 +1,160 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// newProfilePicker builds the connection profile picker with buttons to add,
+// rename, delete, import and export profiles. Picking a profile calls load
+// to fill the connection form; adding one calls save to store the form under
+// the new name. It returns the picker, the bar holding it and a function
+// that reloads the profile names and selects one without loading it.
+func newProfilePicker(myWindow fyne.Window, load func(name string), save func(name string) error) (*widget.Select, fyne.CanvasObject, func(selected string)) {
+	quiet := false
+	picker := widget.NewSelect(nil, func(name string) {
+		if !quiet && name != "" {
+			load(name)
+		}
+	})
+	picker.PlaceHolder = "Connection profile"
+
+	refresh := func(selected string) {
+		names, _, err := listProfiles()
+		if err != nil {
+			log.Printf("Error loading profiles: %v", err)
+			dialog.ShowError(err, myWindow)
+			return
+		}
+		quiet = true
+		defer func() { quiet = false }()
+		picker.Options = names
+		picker.Refresh()
+		if selected == "" {
+			picker.ClearSelected()
+		} else {
+			picker.SetSelected(selected)
+		}
+	}
+
+	askName := func(title, confirm, current string, done func(name string)) {
+		entry := widget.NewEntry()
+		entry.SetPlaceHolder("Profile name, e.g. staging")
+		entry.SetText(current)
+		items := []*widget.FormItem{widget.NewFormItem("Name", entry)}
+		dialog.ShowForm(title, confirm, "Cancel", items, func(confirmed bool) {
+			if confirmed {
+				done(entry.Text)
+			}
+		}, myWindow)
+	}
+
+	addButton := widget.NewButton("Save As", func() {
+		askName("Save Connection As", "Save", "", func(name string) {
+			if containsString(picker.Options, name) {
+				dialog.ShowError(fmt.Errorf("a profile named %q already exists", name), myWindow)
+				return
+			}
+			if err := save(name); err != nil {
+				log.Printf("Error saving profile: %v", err)
+				dialog.ShowError(err, myWindow)
+				return
+			}
+			log.Printf("Saved connection profile '%s'", name)
+			refresh(name)
+		})
+	})
+
+	renameButton := widget.NewButton("Rename", func() {
+		oldName := picker.Selected
+		if oldName == "" {
+			return
+		}
+		askName("Rename Profile", "Rename", oldName, func(newName string) {
+			if newName == oldName {
+				return
+			}
+			if err := renameProfile(oldName, newName); err != nil {
+				log.Printf("Error renaming profile: %v", err)
+				dialog.ShowError(err, myWindow)
+				return
+			}
+			log.Printf("Renamed connection profile '%s' to '%s'", oldName, newName)
+			refresh(newName)
+		})
+	})
+
+	deleteButton := widget.NewButton("Delete", func() {
+		name := picker.Selected
+		if name == "" {
+			return
+		}
+		message := fmt.Sprintf("Delete the connection profile '%s' and its saved password?", name)
+		dialog.ShowConfirm("Delete Profile", message, func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+			if err := deleteProfile(name); err != nil {
+				log.Printf("Error deleting profile: %v", err)
+				dialog.ShowError(err, myWindow)
+				return
+			}
+			log.Printf("Deleted connection profile '%s'", name)
+			refresh("")
+		}, myWindow)
+	})
+
+	importButton := widget.NewButton("Import", func() {
+		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				log.Printf("Error opening file dialog: %v", err)
+				dialog.ShowError(err, myWindow)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			defer reader.Close()
+			names, err := importProfiles(reader)
+			if err != nil {
+				log.Printf("Error importing profiles: %v", err)
+				dialog.ShowError(err, myWindow)
+				return
+			}
+			log.Printf("Imported %d connection profiles from %s", len(names), reader.URI().Path())
+			refresh(picker.Selected)
+			dialog.ShowInformation("Import Profiles",
+				fmt.Sprintf("Imported %d profiles. Passwords are not included; enter them before connecting.", len(names)), myWindow)
+		}, myWindow)
+	})
+
+	exportButton := widget.NewButton("Export", func() {
+		dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				log.Printf("Error opening file dialog: %v", err)
+				dialog.ShowError(err, myWindow)
+				return
+			}
+			if writer == nil {
+				return
+			}
+			defer writer.Close()
+			if err := exportProfiles(writer); err != nil {
+				log.Printf("Error exporting profiles: %v", err)
+				dialog.ShowError(err, myWindow)
+				return
+			}
+			log.Printf("Exported connection profiles to %s", writer.URI().Path())
+		}, myWindow)
+	})
+
+	buttons := container.NewHBox(addButton, renameButton, deleteButton, importButton, exportButton)
+	return picker, container.NewBorder(nil, nil, nil, buttons, picker), refresh
+}
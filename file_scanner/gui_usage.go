@@ -0,0 +1,339 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// treemapMaxTiles caps the tiles drawn for one directory. Smaller entries
+// are folded into a single tile that cannot be opened.
+const treemapMaxTiles = 150
+
+// treemapColors are cycled through for directory tiles; files are grey.
+var (
+	treemapColors = []color.NRGBA{
+		{R: 0x1f, G: 0x77, B: 0xb4, A: 0xff},
+		{R: 0x2c, G: 0xa0, B: 0x2c, A: 0xff},
+		{R: 0xd6, G: 0x27, B: 0x28, A: 0xff},
+		{R: 0x94, G: 0x67, B: 0xbd, A: 0xff},
+		{R: 0x8c, G: 0x56, B: 0x4b, A: 0xff},
+		{R: 0xe3, G: 0x77, B: 0xc2, A: 0xff},
+		{R: 0xbc, G: 0xbd, B: 0x22, A: 0xff},
+		{R: 0x17, G: 0xbe, B: 0xcf, A: 0xff},
+		{R: 0xff, G: 0x7f, B: 0x0e, A: 0xff},
+	}
+	treemapFileColor  = color.NRGBA{R: 0x70, G: 0x70, B: 0x70, A: 0xff}
+	treemapOtherColor = color.NRGBA{R: 0x50, G: 0x50, B: 0x50, A: 0xff}
+	treemapTextColor  = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+)
+
+// usageTreemap draws the entries of one directory as nested rectangles whose
+// areas are proportional to their sizes. Tapping a tile calls OnTapped with
+// its entry.
+type usageTreemap struct {
+	widget.BaseWidget
+	entries  []FileInfo
+	OnTapped func(entry FileInfo)
+}
+
+func newUsageTreemap() *usageTreemap {
+	t := &usageTreemap{}
+	t.ExtendBaseWidget(t)
+	return t
+}
+
+// SetEntries replaces the entries shown, which must be sorted largest first.
+func (t *usageTreemap) SetEntries(entries []FileInfo) {
+	t.entries = entries
+	t.Refresh()
+}
+
+func (t *usageTreemap) tiles(size fyne.Size) []treemapRect {
+	values := make([]float64, len(t.entries))
+	for i, entry := range t.entries {
+		values[i] = float64(entry.FileSize)
+	}
+	return layoutTreemap(values, treemapRect{W: float64(size.Width), H: float64(size.Height)})
+}
+
+func (t *usageTreemap) Tapped(event *fyne.PointEvent) {
+	if t.OnTapped == nil {
+		return
+	}
+	for i, tile := range t.tiles(t.Size()) {
+		if tile.contains(float64(event.Position.X), float64(event.Position.Y)) {
+			t.OnTapped(t.entries[i])
+			return
+		}
+	}
+}
+
+func (t *usageTreemap) CreateRenderer() fyne.WidgetRenderer {
+	return &usageTreemapRenderer{treemap: t}
+}
+
+type usageTreemapRenderer struct {
+	treemap *usageTreemap
+	objects []fyne.CanvasObject
+}
+
+// Layout rebuilds the tiles, since their arrangement depends on the size.
+func (r *usageTreemapRenderer) Layout(size fyne.Size) {
+	r.objects = r.objects[:0]
+	for i, tile := range r.treemap.tiles(size) {
+		if tile.W < 1 || tile.H < 1 {
+			continue
+		}
+		entry := r.treemap.entries[i]
+		fill := treemapFileColor
+		switch {
+		case entry.PathHash == "":
+			fill = treemapOtherColor
+		case entry.IsDir:
+			fill = treemapColors[i%len(treemapColors)]
+		}
+		rect := canvas.NewRectangle(fill)
+		rect.StrokeColor = color.Black
+		rect.StrokeWidth = 1
+		rect.Move(fyne.NewPos(float32(tile.X), float32(tile.Y)))
+		rect.Resize(fyne.NewSize(float32(tile.W), float32(tile.H)))
+		r.objects = append(r.objects, rect)
+
+		// Label tiles with room for at least a few characters.
+		if tile.W < 40 || tile.H < 20 {
+			continue
+		}
+		name := entry.FileName
+		if entry.IsDir {
+			name += string(filepath.Separator)
+		}
+		text := canvas.NewText(fitText(name+" "+formatBytes(entry.FileSize), tile.W-6), treemapTextColor)
+		text.TextSize = 12
+		text.Move(fyne.NewPos(float32(tile.X)+3, float32(tile.Y)+2))
+		r.objects = append(r.objects, text)
+	}
+}
+
+func (r *usageTreemapRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(200, 150)
+}
+
+func (r *usageTreemapRenderer) Refresh() {
+	r.Layout(r.treemap.Size())
+	canvas.Refresh(r.treemap)
+}
+
+func (r *usageTreemapRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *usageTreemapRenderer) Destroy() {}
+
+// fitText shortens text to fit roughly within width at the tile text size.
+func fitText(text string, width float64) string {
+	runes := []rune(text)
+	fits := int(width / 7)
+	if len(runes) <= fits {
+		return text
+	}
+	if fits < 2 {
+		return ""
+	}
+	return string(runes[:fits-1]) + "…"
+}
+
+// treemapEntries sorts the children of a directory for the treemap, drops
+// empty ones and folds the smallest into one entry beyond treemapMaxTiles.
+func treemapEntries(children []FileInfo) []FileInfo {
+	entries := make([]FileInfo, 0, len(children))
+	for _, child := range children {
+		if child.FileSize > 0 {
+			entries = append(entries, child)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].FileSize > entries[j].FileSize })
+	if len(entries) <= treemapMaxTiles {
+		return entries
+	}
+	other := FileInfo{FileName: fmt.Sprintf("%d more", len(entries)-treemapMaxTiles+1)}
+	for _, entry := range entries[treemapMaxTiles-1:] {
+		other.FileSize += entry.FileSize
+	}
+	return append(entries[:treemapMaxTiles-1], other)
+}
+
+// breakdownChoices lists the usage breakdowns offered, with their labels.
+var breakdownChoices = []struct {
+	by, label string
+}{
+	{breakdownExtension, "By extension"},
+	{breakdownAge, "By age"},
+	{breakdownOwner, "By owner"},
+}
+
+// newUsageTab builds the space usage tab: a treemap of the scanned folder
+// that drills down into directories on click, next to a breakdown of the
+// files below the current directory. getFolder supplies the folder of the
+// last scan as the starting point.
+func newUsageTab(getStore func() Storage, getTable func() string, getFolder func() string) fyne.CanvasObject {
+	var groups []UsageGroup
+	var groupTotal int64
+
+	pathEntry := widget.NewEntry()
+	pathEntry.SetPlaceHolder("Folder to show, defaults to the scanned folder")
+	summaryLabel := widget.NewLabel("Scan a folder, then show its space usage")
+	treemap := newUsageTreemap()
+
+	var breakdownLabels []string
+	for _, choice := range breakdownChoices {
+		breakdownLabels = append(breakdownLabels, choice.label)
+	}
+	breakdownSelect := widget.NewSelect(breakdownLabels, nil)
+
+	headers := []string{"Group", "Files", "Size", "Share"}
+	table := widget.NewTable(
+		func() (int, int) { return len(groups) + 1, len(headers) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.TableCellID, cell fyne.CanvasObject) {
+			label := cell.(*widget.Label)
+			if id.Row == 0 {
+				label.SetText(headers[id.Col])
+				return
+			}
+			group := groups[id.Row-1]
+			switch id.Col {
+			case 0:
+				label.SetText(group.Label)
+			case 1:
+				label.SetText(strconv.FormatInt(group.Files, 10))
+			case 2:
+				label.SetText(formatBytes(group.Bytes))
+			case 3:
+				share := 0.0
+				if groupTotal > 0 {
+					share = 100 * float64(group.Bytes) / float64(groupTotal)
+				}
+				label.SetText(fmt.Sprintf("%.1f%%", share))
+			}
+		})
+	table.SetColumnWidth(0, 160)
+	table.SetColumnWidth(1, 80)
+	table.SetColumnWidth(2, 90)
+	table.SetColumnWidth(3, 70)
+
+	// currentPath is the directory shown, empty until the first load.
+	var currentPath string
+
+	loadBreakdown := func(reader CatalogReader, tableName, path string) {
+		by := breakdownChoices[0].by
+		for _, choice := range breakdownChoices {
+			if choice.label == breakdownSelect.Selected {
+				by = choice.by
+			}
+		}
+		found, err := reader.UsageBreakdown(tableName, path, by)
+		if err != nil {
+			log.Printf("Error reading usage breakdown: %v", err)
+			summaryLabel.SetText(fmt.Sprintf("Error reading usage breakdown: %v", err))
+			return
+		}
+		groups = found
+		groupTotal = 0
+		for _, group := range groups {
+			groupTotal += group.Bytes
+		}
+		table.Refresh()
+	}
+
+	var load func(path string)
+	load = func(path string) {
+		reader, ok := getStore().(CatalogReader)
+		tableName := getTable()
+		if !ok || tableName == "" {
+			summaryLabel.SetText("Connect and select a table on the Scan tab first")
+			return
+		}
+		path = strings.TrimSpace(path)
+		if path == "" {
+			path = getFolder()
+		}
+		if path == "" {
+			summaryLabel.SetText("Enter a folder that has been scanned")
+			return
+		}
+		path = filepath.Clean(path)
+
+		summaryLabel.SetText(fmt.Sprintf("Reading usage of %s...", path))
+		go func() {
+			children, err := reader.ListChildren(tableName, path)
+			if err != nil {
+				log.Printf("Error listing %s: %v", path, err)
+				summaryLabel.SetText(fmt.Sprintf("Error listing %s: %v", path, err))
+				return
+			}
+			files, bytes, err := reader.SubtreeTotals(tableName, path)
+			if err != nil {
+				log.Printf("Error reading totals of %s: %v", path, err)
+				summaryLabel.SetText(fmt.Sprintf("Error reading totals of %s: %v", path, err))
+				return
+			}
+			currentPath = path
+			pathEntry.SetText(path)
+			if len(children) == 0 {
+				summaryLabel.SetText(fmt.Sprintf("Nothing catalogued in %s; scan it first", path))
+			} else {
+				summaryLabel.SetText(fmt.Sprintf("%s: %d files, %s", path, files, formatBytes(bytes)))
+			}
+			treemap.SetEntries(treemapEntries(children))
+			loadBreakdown(reader, tableName, path)
+		}()
+	}
+
+	treemap.OnTapped = func(entry FileInfo) {
+		switch {
+		case entry.IsDir:
+			load(entry.FilePath)
+		case entry.PathHash != "":
+			summaryLabel.SetText(fmt.Sprintf("%s: %s", entry.FilePath, formatBytes(entry.FileSize)))
+		}
+	}
+	breakdownSelect.OnChanged = func(string) {
+		reader, ok := getStore().(CatalogReader)
+		if !ok || currentPath == "" {
+			return
+		}
+		tableName := getTable()
+		go loadBreakdown(reader, tableName, currentPath)
+	}
+	breakdownSelect.SetSelected(breakdownChoices[0].label)
+
+	showButton := widget.NewButton("Show", func() { load(pathEntry.Text) })
+	upButton := widget.NewButton("Up", func() {
+		// The catalog holds nothing above the scanned folder.
+		if currentPath == "" || currentPath == filepath.Clean(getFolder()) || currentPath == filepath.Dir(currentPath) {
+			return
+		}
+		load(filepath.Dir(currentPath))
+	})
+
+	controls := container.NewVBox(
+		container.NewBorder(nil, nil, nil, container.NewHBox(showButton, upButton), pathEntry),
+		summaryLabel,
+	)
+	breakdown := container.NewBorder(breakdownSelect, nil, nil, nil, table)
+	split := container.NewHSplit(treemap, breakdown)
+	split.Offset = 0.6
+	return container.NewBorder(controls, nil, nil, nil, split)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/zeebo/blake3"
+)
+
+// Content hash algorithms accepted by ScanOptions.HashAlgorithm. Stored
+// hashes are prefixed with the algorithm name, e.g. "sha256:9f86...", so
+// tables scanned with different algorithms never produce false matches.
+const (
+	hashNone   = ""
+	hashSHA256 = "sha256"
+	hashXXHash = "xxhash"
+	hashBLAKE3 = "blake3"
+)
+
+var hashAlgorithms = []string{hashSHA256, hashXXHash, hashBLAKE3}
+
+func newContentHasher(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case hashSHA256:
+		return sha256.New(), nil
+	case hashXXHash:
+		return xxhash.New(), nil
+	case hashBLAKE3:
+		return blake3.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm %q", algorithm)
+	}
+}
+
+func validateHashAlgorithm(algorithm string) error {
+	if algorithm == hashNone {
+		return nil
+	}
+	_, err := newContentHasher(algorithm)
+	return err
+}
+
+// hashFileContent reads the whole file through the limiter and returns its
+// hash in the "algorithm:hex" form stored in the content_hash column.
+func hashFileContent(ctx context.Context, filePath, algorithm string, limiter *rateLimiter) (string, error) {
+	hasher, err := newContentHasher(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error opening file for hashing: %v", err)
+	}
+	defer file.Close()
+
+	reader := &rateLimitedReader{ctx: ctx, reader: file, limiter: limiter}
+	if _, err := io.Copy(hasher, reader); err != nil {
+		return "", fmt.Errorf("error hashing file: %v", err)
+	}
+	return algorithm + ":" + hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// rateLimiter is a token bucket shared by all scan workers, so the combined
+// rate at which they read file content stays under a byte budget. A nil
+// limiter does not limit.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// wait takes n bytes from the bucket, sleeping for as long as the bucket is
+// in debt. Bursts are capped at one second's worth of bytes.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// rateLimitedReader charges every read against a shared rateLimiter.
+type rateLimitedReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *rateLimiter
+}
+
+// maxLimitedRead keeps single reads small so one worker cannot take a large
+// slice of the budget at once.
+const maxLimitedRead = 64 * 1024
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if r.limiter != nil && len(p) > maxLimitedRead {
+		p = p[:maxLimitedRead]
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.wait(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxIdentifierLength is the limit of SQL Server on identifiers, also used
+// for SQLite, which has none, so that catalogs can move between the two.
+const maxIdentifierLength = 128
+
+// parentIndexSuffix follows the table name in the name of its
+// parent_path_hash index, which must fit the identifier limit too.
+const parentIndexSuffix = "_parent_idx"
+
+// catalogTable is a catalog table name that passed parseCatalogTable, and
+// the schema it was qualified with, if any.
+type catalogTable struct {
+	schema, name string
+}
+
+// parseCatalogTable validates a catalog table name: letters, digits and
+// underscores, not starting with a digit, optionally qualified with a
+// schema of the same form as in inventory.files. Names are checked rather
+// than escaped, so one typed into a dialog or passed with -table can never
+// carry SQL; they are still quoted when put into statements, which keeps
+// names that are also keywords, like "order", working. maxLength is the
+// backend's identifier limit; the table name must leave room for the
+// suffix of its index.
+func parseCatalogTable(name string, maxLength int) (catalogTable, error) {
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 {
+		return catalogTable{}, fmt.Errorf("invalid table name %q: use table or schema.table", name)
+	}
+	for i, part := range parts {
+		limit := maxLength
+		if i == len(parts)-1 {
+			limit -= len(parentIndexSuffix)
+		}
+		if err := checkIdentifier(part, limit); err != nil {
+			return catalogTable{}, fmt.Errorf("invalid table name %q: %v", name, err)
+		}
+	}
+	if len(parts) == 2 {
+		return catalogTable{schema: parts[0], name: parts[1]}, nil
+	}
+	return catalogTable{name: parts[0]}, nil
+}
+
+func checkIdentifier(identifier string, maxLength int) error {
+	if identifier == "" {
+		return fmt.Errorf("empty name")
+	}
+	if len(identifier) > maxLength {
+		return fmt.Errorf("names can be at most %d characters", maxLength)
+	}
+	for i, r := range identifier {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return fmt.Errorf("names may only hold letters, digits and underscores, and cannot start with a digit")
+		}
+	}
+	return nil
+}
+
+// quoted renders the table for a statement, quoting each part.
+func (t catalogTable) quoted(quote func(string) string) string {
+	if t.schema == "" {
+		return quote(t.name)
+	}
+	return quote(t.schema) + "." + quote(t.name)
+}
+
+// parentIndex is the name of the table's parent_path_hash index. Indexes
+// live in the schema of their table, so it is never qualified.
+func (t catalogTable) parentIndex() string {
+	return t.name + parentIndexSuffix
+}
+
+// bracketQuote quotes an identifier for T-SQL.
+func bracketQuote(identifier string) string {
+	return "[" + strings.ReplaceAll(identifier, "]", "]]") + "]"
+}
+
+// doubleQuote quotes an identifier the standard way, for SQLite.
+func doubleQuote(identifier string) string {
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
+
+// postgresQuote quotes an identifier for PostgreSQL. It is lowercased
+// first, as PostgreSQL does with unquoted names, so that tables created
+// before names were quoted are still found.
+func postgresQuote(identifier string) string {
+	return doubleQuote(strings.ToLower(identifier))
+}
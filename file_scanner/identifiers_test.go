@@ -0,0 +1,192 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCatalogTableRejects(t *testing.T) {
+	tests := []struct {
+		name, table string
+	}{
+		{"statement after a bracket", "x]; DROP TABLE y--"},
+		{"statement after a quote", "x'; DROP TABLE y--"},
+		{"statement after a double quote", `x"; DROP TABLE y--`},
+		{"comment", "files--"},
+		{"three parts", "a.b.c"},
+		{"empty", ""},
+		{"empty schema", ".files"},
+		{"empty table", "inventory."},
+		{"leading digit", "1abc"},
+		{"leading digit in the schema", "1inv.files"},
+		{"single quote", "file's"},
+		{"double quote", `file"s`},
+		{"closing bracket", "file]s"},
+		{"opening bracket", "[files]"},
+		{"space", "my files"},
+		{"semicolon", "files;"},
+		{"non-ASCII letter", "fichiers_é"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if table, err := parseCatalogTable(test.table, maxIdentifierLength); err == nil {
+				t.Errorf("parseCatalogTable(%q) = %+v, want an error", test.table, table)
+			}
+			if quoted, err := mssqlTable(test.table); err == nil {
+				t.Errorf("mssqlTable(%q) = %s, want an error", test.table, quoted)
+			}
+			if quoted, err := sqliteTable(test.table); err == nil {
+				t.Errorf("sqliteTable(%q) = %s, want an error", test.table, quoted)
+			}
+			if quoted, err := postgresTable(test.table); err == nil {
+				t.Errorf("postgresTable(%q) = %s, want an error", test.table, quoted)
+			}
+		})
+	}
+}
+
+func TestCatalogTableQuoting(t *testing.T) {
+	tests := []struct {
+		table                   string
+		mssql, sqlite, postgres string
+		sqliteRejectsSchema     bool
+		wantSchema, wantName    string
+	}{
+		{table: "files", mssql: "[files]", sqlite: `"files"`, postgres: `"files"`, wantName: "files"},
+		{table: "Files_2024", mssql: "[Files_2024]", sqlite: `"Files_2024"`, postgres: `"files_2024"`, wantName: "Files_2024"},
+		{table: "_scratch", mssql: "[_scratch]", sqlite: `"_scratch"`, postgres: `"_scratch"`, wantName: "_scratch"},
+		{table: "order", mssql: "[order]", sqlite: `"order"`, postgres: `"order"`, wantName: "order"},
+		{
+			table: "inventory.files", mssql: "[inventory].[files]", postgres: `"inventory"."files"`,
+			sqliteRejectsSchema: true, wantSchema: "inventory", wantName: "files",
+		},
+		{
+			table: "dbo.Files", mssql: "[dbo].[Files]", postgres: `"dbo"."files"`,
+			sqliteRejectsSchema: true, wantSchema: "dbo", wantName: "Files",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.table, func(t *testing.T) {
+			table, err := parseCatalogTable(test.table, maxIdentifierLength)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if table.schema != test.wantSchema || table.name != test.wantName {
+				t.Errorf("parsed %+v, want schema %q and name %q", table, test.wantSchema, test.wantName)
+			}
+			if table.parentIndex() != test.wantName+"_parent_idx" {
+				t.Errorf("parent index %q, want %q", table.parentIndex(), test.wantName+"_parent_idx")
+			}
+
+			if quoted, err := mssqlTable(test.table); err != nil || quoted != test.mssql {
+				t.Errorf("mssqlTable = %s, %v; want %s", quoted, err, test.mssql)
+			}
+			if quoted, err := postgresTable(test.table); err != nil || quoted != test.postgres {
+				t.Errorf("postgresTable = %s, %v; want %s", quoted, err, test.postgres)
+			}
+			quoted, err := sqliteTable(test.table)
+			if test.sqliteRejectsSchema {
+				if err == nil {
+					t.Errorf("sqliteTable = %s, want an error for a schema", quoted)
+				}
+			} else if err != nil || quoted != test.sqlite {
+				t.Errorf("sqliteTable = %s, %v; want %s", quoted, err, test.sqlite)
+			}
+		})
+	}
+}
+
+func TestCatalogTableLengths(t *testing.T) {
+	// Table names leave room for the suffix of their index, schemas may
+	// take the whole limit.
+	mssqlName := maxIdentifierLength - len(parentIndexSuffix)
+	postgresName := postgresMaxIdentifierLength - len(parentIndexSuffix)
+	tests := []struct {
+		backend string
+		table   func(string) (string, error)
+		name    string
+		length  int
+		ok      bool
+	}{
+		{"mssql", mssqlTable, "longest name", mssqlName, true},
+		{"mssql", mssqlTable, "name too long", mssqlName + 1, false},
+		{"mssql", mssqlTable, "longest schema", maxIdentifierLength, true},
+		{"mssql", mssqlTable, "schema too long", maxIdentifierLength + 1, false},
+		{"sqlite", sqliteTable, "longest name", mssqlName, true},
+		{"sqlite", sqliteTable, "name too long", mssqlName + 1, false},
+		{"postgres", postgresTable, "longest name", postgresName, true},
+		{"postgres", postgresTable, "name too long", postgresName + 1, false},
+		{"postgres", postgresTable, "longest schema", postgresMaxIdentifierLength, true},
+		{"postgres", postgresTable, "schema too long", postgresMaxIdentifierLength + 1, false},
+	}
+	for _, test := range tests {
+		t.Run(test.backend+" "+test.name, func(t *testing.T) {
+			name := strings.Repeat("a", test.length)
+			if strings.Contains(test.name, "schema") {
+				name += ".files"
+			}
+			quoted, err := test.table(name)
+			if test.ok && err != nil {
+				t.Errorf("%d characters rejected: %v", test.length, err)
+			}
+			if !test.ok && err == nil {
+				t.Errorf("%d characters accepted as %s", test.length, quoted)
+			}
+		})
+	}
+
+	// The index of the longest accepted name fits the limit exactly.
+	table, err := parseCatalogTable(strings.Repeat("a", postgresName), postgresMaxIdentifierLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table.parentIndex()) != postgresMaxIdentifierLength {
+		t.Errorf("parent index %q has %d characters, want %d", table.parentIndex(), len(table.parentIndex()), postgresMaxIdentifierLength)
+	}
+}
+
+func TestQuoteEscaping(t *testing.T) {
+	tests := []struct {
+		identifier, bracket, double, postgres string
+	}{
+		{"files", "[files]", `"files"`, `"files"`},
+		{"a]b", "[a]]b]", `"a]b"`, `"a]b"`},
+		{`a"b`, `[a"b]`, `"a""b"`, `"a""b"`},
+		{"x]; DROP TABLE y--", "[x]]; DROP TABLE y--]", `"x]; DROP TABLE y--"`, `"x]; drop table y--"`},
+	}
+	for _, test := range tests {
+		if got := bracketQuote(test.identifier); got != test.bracket {
+			t.Errorf("bracketQuote(%q) = %s, want %s", test.identifier, got, test.bracket)
+		}
+		if got := doubleQuote(test.identifier); got != test.double {
+			t.Errorf("doubleQuote(%q) = %s, want %s", test.identifier, got, test.double)
+		}
+		if got := postgresQuote(test.identifier); got != test.postgres {
+			t.Errorf("postgresQuote(%q) = %s, want %s", test.identifier, got, test.postgres)
+		}
+	}
+}
+
+func TestSQLiteCatalogNames(t *testing.T) {
+	store := openTestCatalog(t)
+	for _, name := range []string{"x]; DROP TABLE files--", `files"; DROP TABLE files; --`, "inventory.files"} {
+		if err := store.CreateCatalog(name); err == nil {
+			t.Errorf("CreateCatalog(%q) succeeded, want an error", name)
+		}
+		if err := store.UpsertBatch(name, []FileInfo{{FileName: "a", FilePath: "/a", PathHash: pathHash("/a")}}); err == nil {
+			t.Errorf("UpsertBatch(%q) succeeded, want an error", name)
+		}
+	}
+
+	// A keyword works as a name once quoted.
+	if err := store.CreateCatalog("order"); err != nil {
+		t.Fatal(err)
+	}
+	tables, err := store.ListCatalogs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(tables, ",") != "files,order" {
+		t.Errorf("tables %v, want files and order", tables)
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ImportSummary counts the rows of an import by what they did to the
+// catalog, or would do in a dry run.
+type ImportSummary struct {
+	Rows    int64
+	Inserts int64
+	Updates int64
+}
+
+// importFormats lists the formats importCatalog reads: the text formats of
+// export and of the files backend.
+var importFormats = []string{"csv", "ndjson"}
+
+// importRequired are the columns every imported row needs. The others
+// default to empty.
+var importRequired = []string{"file_name", "file_path", "path_hash", "file_size", "mod_time"}
+
+// maxImportLine bounds an NDJSON line, which holds a file's metadata.
+const maxImportLine = 16 * 1024 * 1024
+
+// importCatalog reads an inventory written by export or the files backend
+// from r and upserts its rows into the catalog in batches, like a scan.
+// Gzip and zstd input is recognised from its first bytes. Columns must be
+// those of a catalog and every row is validated; the first invalid row
+// stops the import with its line number, after the batches before it were
+// written. A dry run writes nothing and only counts what would be inserted
+// and updated. A path that occurs more than once counts as an update after
+// its first row, and the last row wins.
+func importCatalog(ctx context.Context, store Storage, tableName string, r io.Reader, format string, dryRun bool) (ImportSummary, error) {
+	var summary ImportSummary
+	tracker, ok := store.(ChangeTracker)
+	if !ok {
+		return summary, fmt.Errorf("this storage backend does not support import")
+	}
+	names, err := store.ListCatalogs()
+	if err != nil {
+		return summary, err
+	}
+	exists := containsString(names, tableName)
+	if !exists && !dryRun {
+		if err := store.CreateCatalog(tableName); err != nil {
+			return summary, err
+		}
+		exists = true
+	}
+
+	r, closeInput, err := decompressInput(r)
+	if err != nil {
+		return summary, err
+	}
+	defer closeInput()
+
+	size := batchSize
+	if sizer, ok := store.(batchSizer); ok {
+		size = sizer.BatchSize()
+	}
+	batch := make([]FileInfo, 0, size)
+	inBatch := make(map[string]int)
+	// added holds the paths counted as inserts that a lookup cannot find
+	// yet: those of the current batch, or all of them in a dry run.
+	added := make(map[string]bool)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		states := map[string]FileState{}
+		if exists {
+			pathHashes := make([]string, len(batch))
+			for i, file := range batch {
+				pathHashes[i] = file.PathHash
+			}
+			var err error
+			if states, err = tracker.LookupFiles(tableName, pathHashes); err != nil {
+				return err
+			}
+		}
+		for _, file := range batch {
+			if _, ok := states[file.PathHash]; ok || added[file.PathHash] {
+				summary.Updates++
+			} else {
+				added[file.PathHash] = true
+				summary.Inserts++
+			}
+		}
+		if !dryRun {
+			if err := store.UpsertBatch(tableName, batch); err != nil {
+				return err
+			}
+			added = make(map[string]bool)
+		}
+		batch = batch[:0]
+		inBatch = make(map[string]int)
+		return nil
+	}
+
+	err = readImportRows(r, format, func(file FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		summary.Rows++
+		if i, ok := inBatch[file.PathHash]; ok {
+			batch[i] = file
+			summary.Updates++
+			return nil
+		}
+		inBatch[file.PathHash] = len(batch)
+		batch = append(batch, file)
+		if len(batch) >= size {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return summary, err
+	}
+	if !dryRun {
+		if err := store.Finalize(tableName); err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
+
+// decompressInput unwraps gzip or zstd compressed input.
+func decompressInput(r io.Reader) (io.Reader, func(), error) {
+	buffered := bufio.NewReader(r)
+	magic, _ := buffered.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading gzip input: %v", err)
+		}
+		return gz, func() { gz.Close() }, nil
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		decoder, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading zstd input: %v", err)
+		}
+		return decoder, decoder.Close, nil
+	}
+	return buffered, func() {}, nil
+}
+
+// readImportRows calls fn with every row of the input. Errors are prefixed
+// with the line they were found on.
+func readImportRows(r io.Reader, format string, fn func(FileInfo) error) error {
+	switch format {
+	case "csv":
+		return readCSVRows(r, fn)
+	case "ndjson":
+		return readNDJSONRows(r, fn)
+	default:
+		return fmt.Errorf("unknown import format %q", format)
+	}
+}
+
+// importColumns resolves the names of the input's columns, rejecting
+// unknown, repeated and missing ones.
+func importColumns(names []string) ([]exportColumn, error) {
+	columns := make([]exportColumn, len(names))
+	seen := make(map[string]bool)
+	for i, name := range names {
+		found := false
+		for _, column := range exportColumns {
+			if column.name == name {
+				columns[i], found = column, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("column %q appears twice", name)
+		}
+		seen[name] = true
+	}
+	for _, name := range importRequired {
+		if !seen[name] {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+	return columns, nil
+}
+
+func readCSVRows(r io.Reader, fn func(FileInfo) error) error {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading CSV header: %v", err)
+	}
+	columns, err := importColumns(header)
+	if err != nil {
+		return fmt.Errorf("line 1: %v", err)
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading CSV: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		var file FileInfo
+		for i, column := range columns {
+			value, err := parseImportText(column.kind, record[i])
+			if err != nil {
+				return fmt.Errorf("line %d: %s: %v", line, column.name, err)
+			}
+			setImportValue(&file, column.name, value)
+		}
+		if err := checkImportRow(file); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		if err := fn(file); err != nil {
+			return err
+		}
+	}
+}
+
+// parseImportText parses a CSV value of kind, the reverse of exportText.
+func parseImportText(kind int, text string) (interface{}, error) {
+	switch kind {
+	case exportInt32:
+		n, err := strconv.ParseInt(text, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", text)
+		}
+		return int32(n), nil
+	case exportInt64:
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", text)
+		}
+		return n, nil
+	case exportBool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean %q", text)
+		}
+		return b, nil
+	case exportTime:
+		if text == "" {
+			return time.Time{}, nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time %q", text)
+		}
+		return t, nil
+	default:
+		return text, nil
+	}
+}
+
+func readNDJSONRows(r io.Reader, fn func(FileInfo) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(data, &object); err != nil {
+			return fmt.Errorf("line %d: invalid JSON: %v", line, err)
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		columns, err := importColumns(names)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+
+		var file FileInfo
+		for _, column := range columns {
+			value, err := parseImportJSON(column.kind, object[column.name])
+			if err != nil {
+				return fmt.Errorf("line %d: %s: %v", line, column.name, err)
+			}
+			setImportValue(&file, column.name, value)
+		}
+		if err := checkImportRow(file); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		if err := fn(file); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("line %d: error reading JSON lines: %v", line+1, err)
+	}
+	return nil
+}
+
+// parseImportJSON parses an NDJSON value of kind. Nulls are empty values
+// and other_metadata may be an embedded object.
+func parseImportJSON(kind int, raw json.RawMessage) (interface{}, error) {
+	null := bytes.Equal(raw, []byte("null"))
+	switch kind {
+	case exportInt32:
+		var n int32
+		if err := json.Unmarshal(raw, &n); err != nil || null {
+			return nil, fmt.Errorf("invalid number %s", raw)
+		}
+		return n, nil
+	case exportInt64:
+		var n int64
+		if err := json.Unmarshal(raw, &n); err != nil || null {
+			return nil, fmt.Errorf("invalid number %s", raw)
+		}
+		return n, nil
+	case exportBool:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil || null {
+			return nil, fmt.Errorf("invalid boolean %s", raw)
+		}
+		return b, nil
+	case exportTime:
+		var t time.Time
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return nil, fmt.Errorf("invalid time %s", raw)
+		}
+		return t, nil
+	case exportJSON:
+		if null {
+			return "", nil
+		}
+		if raw[0] != '"' {
+			var document bytes.Buffer
+			if err := json.Compact(&document, raw); err != nil {
+				return nil, err
+			}
+			return document.String(), nil
+		}
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("invalid string %s", raw)
+	}
+	return s, nil
+}
+
+// setImportValue stores a parsed value in its FileInfo field. Times are
+// stored the way a scan writes them: mod_time in local time and last_seen
+// in UTC.
+func setImportValue(file *FileInfo, name string, value interface{}) {
+	switch name {
+	case "file_name":
+		file.FileName = value.(string)
+	case "file_path":
+		file.FilePath = value.(string)
+	case "path_hash":
+		file.PathHash = value.(string)
+	case "file_size":
+		file.FileSize = value.(int64)
+	case "mod_time":
+		file.ModTime = value.(time.Time).Local()
+	case "other_metadata":
+		file.OtherMetadata = value.(string)
+	case "extension":
+		file.Extension = value.(string)
+	case "content_hash":
+		file.ContentHash = value.(string)
+	case "last_seen":
+		if t := value.(time.Time); !t.IsZero() {
+			file.LastSeen = t.UTC()
+		}
+	case "mime_type":
+		file.MIMEType = value.(string)
+	case "mime_mismatch":
+		file.MIMEMismatch = value.(bool)
+	case "parent_path_hash":
+		file.ParentHash = value.(string)
+	case "is_dir":
+		file.IsDir = value.(bool)
+	case "file_count":
+		file.FileCount = value.(int64)
+	case "depth":
+		file.Depth = int(value.(int32))
+	}
+}
+
+// checkImportRow rejects rows a scan could not have written.
+func checkImportRow(file FileInfo) error {
+	switch {
+	case file.FilePath == "":
+		return fmt.Errorf("empty file_path")
+	case file.PathHash != pathHash(file.FilePath):
+		return fmt.Errorf("path_hash does not match file_path %q", file.FilePath)
+	case file.FileSize < 0:
+		return fmt.Errorf("negative file_size")
+	case file.ModTime.IsZero():
+		return fmt.Errorf("empty mod_time")
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// importCSV returns a CSV inventory with the required columns and a row of
+// the given size for every path.
+func importCSV(paths []string, size int64) string {
+	var b strings.Builder
+	b.WriteString("file_name,file_path,path_hash,file_size,mod_time\n")
+	for _, path := range paths {
+		name := path[strings.LastIndex(path, "/")+1:]
+		fmt.Fprintf(&b, "%s,%s,%s,%d,2024-05-06T07:08:09Z\n", name, path, pathHash(path), size)
+	}
+	return b.String()
+}
+
+func TestImportCatalogRejects(t *testing.T) {
+	good := fmt.Sprintf(`"file_name":"a.txt","file_path":"/data/a.txt","path_hash":%q,"file_size":1,"mod_time":"2024-05-06T07:08:09Z"`, pathHash("/data/a.txt"))
+	tests := []struct {
+		name, format, input, wantErr string
+	}{
+		{"unknown CSV column", "csv", "file_name,file_path,path_hash,file_size,mod_time,colour\n", `line 1: unknown column "colour"`},
+		{"missing CSV column", "csv", "file_name,file_path,path_hash,file_size\n", `line 1: missing column "mod_time"`},
+		{"repeated CSV column", "csv", "file_name,file_path,path_hash,file_size,mod_time,file_size\n", `line 1: column "file_size" appears twice`},
+		{
+			"CSV path_hash of another path", "csv",
+			"file_name,file_path,path_hash,file_size,mod_time\n" +
+				"a.txt,/data/a.txt," + pathHash("/data/b.txt") + ",1,2024-05-06T07:08:09Z\n",
+			"line 2: path_hash does not match",
+		},
+		{"unknown NDJSON key", "ndjson", "{" + good + `,"colour":"red"}` + "\n", `line 1: unknown column "colour"`},
+		{"missing NDJSON key", "ndjson", `{"file_name":"a.txt","file_path":"/data/a.txt"}` + "\n", "line 1: missing column"},
+		{
+			"NDJSON path_hash of another path", "ndjson",
+			"{" + good + "}\n" + "{" + strings.Replace(good, `"/data/a.txt"`, `"/data/c.txt"`, 1) + "}\n",
+			"line 2: path_hash does not match",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := openTestCatalog(t)
+			_, err := importCatalog(context.Background(), store, "files", strings.NewReader(test.input), test.format, false)
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("importCatalog error %v, want %q", err, test.wantErr)
+			}
+			if state := catalogState(t, store); len(state) != 0 {
+				t.Errorf("a rejected import wrote %v", state)
+			}
+		})
+	}
+}
+
+func TestImportCatalogDryRun(t *testing.T) {
+	ctx := context.Background()
+	store := openTestCatalog(t)
+	existing := []string{"/data/a.txt", "/data/b.txt"}
+	if _, err := importCatalog(ctx, store, "files", strings.NewReader(importCSV(existing, 1)), "csv", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// One existing path, two new ones and a new path repeated: two inserts
+	// and two updates.
+	input := importCSV([]string{"/data/b.txt", "/data/c.txt", "/data/d.txt", "/data/c.txt"}, 5)
+	want := ImportSummary{Rows: 4, Inserts: 2, Updates: 2}
+
+	dry, err := importCatalog(ctx, store, "files", strings.NewReader(input), "csv", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dry != want {
+		t.Errorf("dry run summary %+v, want %+v", dry, want)
+	}
+	if state := catalogState(t, store); len(state) != len(existing) {
+		t.Errorf("dry run changed the catalog to %v", state)
+	}
+	var size int64
+	if err := store.(*sqliteStorage).db.QueryRow(`SELECT file_size FROM files WHERE file_path = '/data/b.txt'`).Scan(&size); err != nil || size != 1 {
+		t.Errorf("dry run left /data/b.txt with size %d, %v; want 1", size, err)
+	}
+
+	// A dry run into a catalog that does not exist counts every path as
+	// new and does not create it.
+	fresh, err := importCatalog(ctx, store, "archive", strings.NewReader(input), "csv", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh != (ImportSummary{Rows: 4, Inserts: 3, Updates: 1}) {
+		t.Errorf("dry run into a new catalog summary %+v, want 3 inserts and 1 update", fresh)
+	}
+	if names, err := store.ListCatalogs(); err != nil || containsString(names, "archive") {
+		t.Errorf("dry run created the catalog: %v, %v", names, err)
+	}
+
+	imported, err := importCatalog(ctx, store, "files", strings.NewReader(input), "csv", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != dry {
+		t.Errorf("import summary %+v, dry run said %+v", imported, dry)
+	}
+	state := catalogState(t, store)
+	for _, path := range []string{"/data/a.txt", "/data/b.txt", "/data/c.txt", "/data/d.txt"} {
+		if _, ok := state[path]; !ok {
+			t.Errorf("no row for %s after the import", path)
+		}
+	}
+	if len(state) != 4 {
+		t.Errorf("catalog holds %v, want 4 files", state)
+	}
+}
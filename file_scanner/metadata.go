@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// metadataVersion is stored as "v" so readers can tell layouts apart if the
+// schema ever changes incompatibly.
+const metadataVersion = 1
+
+// FileMetadata is the JSON document stored in the other_metadata column.
+// Fields a platform cannot provide are left out:
+//
+//	v            schema version, currently 1
+//	mode         permission string as printed by ls, e.g. "-rw-r--r--"
+//	perm         permission bits in octal, e.g. "0644"
+//	symlink      true when the scanned path is a symbolic link; the other
+//	             fields then describe the file it points to
+//	link_target  where a symbolic link points, as stored in the link
+//	uid, gid     numeric owner and group (Unix)
+//	owner, group owner and group names, when they can be resolved (Unix)
+//	inode, device, links
+//	             inode number, device ID and hard link count (Unix)
+//	atime, ctime last access and last status change, RFC 3339 in UTC (Unix)
+//	btime        creation time, RFC 3339 in UTC (Windows)
+//	attributes   file attributes such as "hidden", "readonly" or "system"
+//	             (Windows)
+//	extractor    name of the content extractor that produced "content":
+//	             "exif", "pdf", "id3" or "ooxml" (only when content
+//	             extraction is enabled)
+//	content      fields read from the file itself, such as camera_model,
+//	             pages, author or artist
+//
+// Each backend can query the document with its JSON functions:
+//
+//	SQL Server:  SELECT file_path FROM files WHERE JSON_VALUE(other_metadata, '$.owner') = 'alice'
+//	PostgreSQL:  SELECT file_path FROM files WHERE (other_metadata::jsonb ->> 'links')::int > 1
+//	SQLite:      SELECT file_path FROM files WHERE json_extract(other_metadata, '$.symlink') = 1
+//	SQLite:      SELECT file_path FROM files WHERE json_extract(other_metadata, '$.content.pages') > 100
+type FileMetadata struct {
+	Version    int        `json:"v"`
+	Mode       string     `json:"mode"`
+	Perm       string     `json:"perm"`
+	Symlink    bool       `json:"symlink"`
+	LinkTarget string     `json:"link_target,omitempty"`
+	UID        *uint32    `json:"uid,omitempty"`
+	GID        *uint32    `json:"gid,omitempty"`
+	Owner      string     `json:"owner,omitempty"`
+	Group      string     `json:"group,omitempty"`
+	Inode      uint64     `json:"inode,omitempty"`
+	Device     uint64     `json:"device,omitempty"`
+	Links      uint64     `json:"links,omitempty"`
+	AccessTime *time.Time `json:"atime,omitempty"`
+	ChangeTime *time.Time `json:"ctime,omitempty"`
+	BirthTime  *time.Time `json:"btime,omitempty"`
+	Attributes []string   `json:"attributes,omitempty"`
+
+	Extractor string                 `json:"extractor,omitempty"`
+	Content   map[string]interface{} `json:"content,omitempty"`
+}
+
+// collectMetadata describes the file at path. info is the result of
+// os.Stat, and link of os.Lstat, which differ only for symbolic links.
+func collectMetadata(path string, info, link os.FileInfo) FileMetadata {
+	metadata := FileMetadata{
+		Version: metadataVersion,
+		Mode:    info.Mode().String(),
+		Perm:    "0" + strconv.FormatUint(uint64(info.Mode().Perm()), 8),
+	}
+	if link.Mode()&os.ModeSymlink != 0 {
+		metadata.Symlink = true
+		if target, err := os.Readlink(path); err == nil {
+			metadata.LinkTarget = target
+		}
+	}
+	platformMetadata(info, &metadata)
+	return metadata
+}
+
+// encodeMetadata renders the metadata for the other_metadata column.
+func encodeMetadata(metadata FileMetadata) string {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// utcTime returns a pointer for the optional time fields of FileMetadata.
+func utcTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+// nameCache remembers user and group names by ID, since every file of a
+// scan asks for the same few.
+type nameCache struct {
+	mu     sync.Mutex
+	names  map[string]string
+	lookup func(id string) (string, error)
+}
+
+func (c *nameCache) get(id uint32) string {
+	key := strconv.FormatUint(uint64(id), 10)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if name, ok := c.names[key]; ok {
+		return name
+	}
+	name, err := c.lookup(key)
+	if err != nil {
+		name = ""
+	}
+	c.names[key] = name
+	return name
+}
+
+var (
+	userNames = &nameCache{names: make(map[string]string), lookup: func(id string) (string, error) {
+		u, err := user.LookupId(id)
+		if err != nil {
+			return "", err
+		}
+		return u.Username, nil
+	}}
+	groupNames = &nameCache{names: make(map[string]string), lookup: func(id string) (string, error) {
+		g, err := user.LookupGroupId(id)
+		if err != nil {
+			return "", err
+		}
+		return g.Name, nil
+	}}
+)
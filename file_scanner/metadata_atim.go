@@ -0,0 +1,13 @@
+//go:build linux || openbsd || dragonfly || solaris
+
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+// statTimes returns the access and status change times of a stat result.
+func statTimes(st *syscall.Stat_t) (time.Time, time.Time) {
+	return time.Unix(st.Atim.Unix()), time.Unix(st.Ctim.Unix())
+}
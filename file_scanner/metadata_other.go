@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package main
+
+import "os"
+
+// platformMetadata has nothing to add beyond the portable fields here.
+func platformMetadata(info os.FileInfo, metadata *FileMetadata) {}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// platformMetadata adds ownership, inode and time fields from stat(2).
+func platformMetadata(info os.FileInfo, metadata *FileMetadata) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	uid, gid := st.Uid, st.Gid
+	metadata.UID = &uid
+	metadata.GID = &gid
+	metadata.Owner = userNames.get(uid)
+	metadata.Group = groupNames.get(gid)
+	metadata.Inode = uint64(st.Ino)
+	metadata.Device = uint64(st.Dev)
+	metadata.Links = uint64(st.Nlink)
+	atime, ctime := statTimes(st)
+	metadata.AccessTime = utcTime(atime)
+	metadata.ChangeTime = utcTime(ctime)
+}
@@ -0,0 +1,13 @@
+//go:build unix && !linux && !openbsd && !dragonfly && !solaris && !darwin && !freebsd && !netbsd
+
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+// statTimes is not implemented on this platform; the times are left out.
+func statTimes(st *syscall.Stat_t) (time.Time, time.Time) {
+	return time.Time{}, time.Time{}
+}
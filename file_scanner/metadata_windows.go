@@ -0,0 +1,43 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// windowsAttributes names the file attribute bits worth reporting.
+var windowsAttributes = []struct {
+	bit  uint32
+	name string
+}{
+	{0x1, "readonly"},
+	{0x2, "hidden"},
+	{0x4, "system"},
+	{0x20, "archive"},
+	{0x100, "temporary"},
+	{0x200, "sparse"},
+	{0x400, "reparse_point"},
+	{0x800, "compressed"},
+	{0x1000, "offline"},
+	{0x4000, "encrypted"},
+}
+
+// platformMetadata adds the attributes and creation and access times from
+// the directory entry. Ownership needs the security descriptor, which is
+// not read.
+func platformMetadata(info os.FileInfo, metadata *FileMetadata) {
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return
+	}
+	for _, attribute := range windowsAttributes {
+		if data.FileAttributes&attribute.bit != 0 {
+			metadata.Attributes = append(metadata.Attributes, attribute.name)
+		}
+	}
+	metadata.BirthTime = utcTime(time.Unix(0, data.CreationTime.Nanoseconds()))
+	metadata.AccessTime = utcTime(time.Unix(0, data.LastAccessTime.Nanoseconds()))
+}
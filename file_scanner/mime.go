@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// sniffSize is how much of a file is read to detect its type, the most
+// http.DetectContentType looks at.
+const sniffSize = 512
+
+// extraSignatures cover types http.DetectContentType does not know, chiefly
+// executables, which matter most when auditing shares for disguised files.
+// They are checked first.
+var extraSignatures = []struct {
+	magic    []byte
+	mimeType string
+}{
+	{[]byte("\x7FELF"), "application/x-elf"},
+	{[]byte("\xCF\xFA\xED\xFE"), "application/x-mach-binary"},
+	{[]byte("\xCE\xFA\xED\xFE"), "application/x-mach-binary"},
+	{[]byte("#!/"), "text/x-shellscript"},
+	{[]byte("II*\x00"), "image/tiff"},
+	{[]byte("MM\x00*"), "image/tiff"},
+	{[]byte("7z\xBC\xAF\x27\x1C"), "application/x-7z-compressed"},
+	{[]byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1"), "application/x-ole-storage"},
+	{[]byte("SQLite format 3\x00"), "application/vnd.sqlite3"},
+	{[]byte("fLaC"), "audio/flac"},
+}
+
+// sniffMIME returns the media type of data, without parameters such as the
+// charset. Unrecognised binary data is "application/octet-stream".
+func sniffMIME(data []byte) string {
+	if isPortableExecutable(data) {
+		return "application/vnd.microsoft.portable-executable"
+	}
+	for _, signature := range extraSignatures {
+		if bytes.HasPrefix(data, signature.magic) {
+			return signature.mimeType
+		}
+	}
+	mimeType := http.DetectContentType(data)
+	if i := strings.IndexByte(mimeType, ';'); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	return mimeType
+}
+
+// isPortableExecutable checks for the MZ header of Windows executables and
+// the PE header it points to, or when that lies beyond data, for a plausible
+// offset. "MZ" alone is too common at the start of text to be trusted.
+func isPortableExecutable(data []byte) bool {
+	if len(data) < 0x40 || !bytes.HasPrefix(data, []byte("MZ")) {
+		return false
+	}
+	offset := int64(binary.LittleEndian.Uint32(data[0x3C:0x40]))
+	if offset+4 > int64(len(data)) {
+		return offset >= 0x40 && offset < 0x10000
+	}
+	return bytes.Equal(data[offset:offset+4], []byte("PE\x00\x00"))
+}
+
+// extensionTypes lists, for extensions whose content can be recognised, the
+// sniffed types that are consistent with them. Container formats such as
+// Office documents sniff as the container. Extensions that are not listed
+// are never reported as a mismatch.
+var extensionTypes = map[string][]string{
+	"jpg": {"image/jpeg"}, "jpeg": {"image/jpeg"}, "jpe": {"image/jpeg"},
+	"png":  {"image/png"},
+	"gif":  {"image/gif"},
+	"bmp":  {"image/bmp"},
+	"webp": {"image/webp"},
+	"ico":  {"image/x-icon"},
+	"tif":  {"image/tiff"}, "tiff": {"image/tiff"},
+	"pdf":  {"application/pdf"},
+	"ps":   {"application/postscript"},
+	"zip":  {"application/zip"},
+	"docx": {"application/zip"}, "xlsx": {"application/zip"}, "pptx": {"application/zip"},
+	"docm": {"application/zip"}, "xlsm": {"application/zip"}, "pptm": {"application/zip"},
+	"odt": {"application/zip"}, "ods": {"application/zip"}, "odp": {"application/zip"},
+	"epub": {"application/zip"}, "jar": {"application/zip"}, "apk": {"application/zip"},
+	// Word and Excel also save RTF, HTML and CSV under their old extensions.
+	"doc": {"application/x-ole-storage", "text/plain"},
+	"xls": {"application/x-ole-storage", "text/plain", "text/html"},
+	"ppt": {"application/x-ole-storage"}, "msg": {"application/x-ole-storage"},
+	"msi": {"application/x-ole-storage"},
+	"gz":  {"application/x-gzip"}, "tgz": {"application/x-gzip"},
+	"rar":  {"application/x-rar-compressed"},
+	"7z":   {"application/x-7z-compressed"},
+	"mp3":  {"audio/mpeg"},
+	"wav":  {"audio/wave"},
+	"flac": {"audio/flac"},
+	"ogg":  {"application/ogg"}, "oga": {"application/ogg"}, "ogv": {"application/ogg"},
+	"mid": {"audio/midi"}, "midi": {"audio/midi"},
+	"aif": {"audio/aiff"}, "aiff": {"audio/aiff"},
+	"mp4": {"video/mp4"}, "m4v": {"video/mp4"}, "m4a": {"video/mp4"},
+	"avi":  {"video/avi"},
+	"webm": {"video/webm"}, "mkv": {"video/webm"},
+	"exe":    {"application/vnd.microsoft.portable-executable"},
+	"dll":    {"application/vnd.microsoft.portable-executable"},
+	"sys":    {"application/vnd.microsoft.portable-executable"},
+	"scr":    {"application/vnd.microsoft.portable-executable"},
+	"sqlite": {"application/vnd.sqlite3"}, "sqlite3": {"application/vnd.sqlite3"},
+	"txt": textTypes, "csv": textTypes, "tsv": textTypes, "log": textTypes,
+	"md": textTypes, "json": textTypes, "ini": textTypes, "cfg": textTypes,
+	"html": textTypes, "htm": textTypes, "xml": textTypes, "svg": textTypes,
+	"sh": textTypes, "ps1": textTypes, "bat": textTypes, "cmd": textTypes,
+}
+
+// textTypes are what plain text files can sniff as. Markup is only
+// recognised when a tag comes first, so text and markup extensions accept
+// either.
+var textTypes = []string{"text/plain", "text/html", "text/xml", "text/x-shellscript"}
+
+// mimeMismatch reports whether mimeType contradicts the file's extension.
+// Files whose type could not be recognised never mismatch.
+func mimeMismatch(extension, mimeType string) bool {
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		return false
+	}
+	accepted, ok := extensionTypes[strings.ToLower(strings.TrimPrefix(extension, "."))]
+	if !ok {
+		return false
+	}
+	for _, candidate := range accepted {
+		if candidate == mimeType {
+			return false
+		}
+	}
+	return true
+}
+
+// detectMIME fills in MIMEType and MIMEMismatch from the start of the file.
+// Empty files have no type.
+func detectMIME(file *FileInfo) error {
+	if file.FileSize == 0 {
+		return nil
+	}
+	f, err := os.Open(file.FilePath)
+	if err != nil {
+		return fmt.Errorf("error opening file: %v", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, sniffSize)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("error reading file: %v", err)
+	}
+	file.MIMEType = sniffMIME(header[:n])
+	file.MIMEMismatch = mimeMismatch(file.Extension, file.MIMEType)
+	return nil
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// parquetRowGroupSize is how many rows are buffered before a row group is
+// written, which bounds the memory an export uses.
+const parquetRowGroupSize = 20000
+
+// Parquet physical types, repetitions, converted types and encodings, as
+// numbered in parquet.thrift.
+const (
+	parquetBoolean   = 0
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+
+	parquetPlain = 0
+	parquetRLE   = 3
+)
+
+var parquetMagic = []byte("PAR1")
+
+// parquetWriter writes rows to a Parquet file with a flat schema derived
+// from the export columns. This is a minimal writer: each column chunk is a
+// single uncompressed data page with PLAIN values, which every Parquet
+// reader understands. Only time columns are optional.
+type parquetWriter struct {
+	w         *countingWriter
+	columns   []exportColumn
+	values    [][]interface{}
+	rowGroups []parquetRowGroup
+	rows      int64
+	err       error
+}
+
+type parquetRowGroup struct {
+	chunks []parquetChunk
+	rows   int64
+	size   int64
+}
+
+type parquetChunk struct {
+	offset int64
+	size   int64
+	values int64
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func newParquetWriter(w io.Writer, columns []exportColumn) *parquetWriter {
+	p := &parquetWriter{
+		w:       &countingWriter{w: w},
+		columns: columns,
+		values:  make([][]interface{}, len(columns)),
+	}
+	_, p.err = p.w.Write(parquetMagic)
+	return p
+}
+
+func (p *parquetWriter) Write(file FileInfo) error {
+	if p.err != nil {
+		return p.err
+	}
+	for i, column := range p.columns {
+		p.values[i] = append(p.values[i], column.value(file))
+	}
+	if len(p.values[0]) >= parquetRowGroupSize {
+		p.err = p.flush()
+	}
+	return p.err
+}
+
+// flush writes the buffered rows as a row group.
+func (p *parquetWriter) flush() error {
+	rows := len(p.values[0])
+	if rows == 0 {
+		return nil
+	}
+	group := parquetRowGroup{rows: int64(rows)}
+	for i, column := range p.columns {
+		page := parquetPage(column, p.values[i])
+		var header thriftWriter
+		header.fieldI32(1, 0) // DATA_PAGE
+		header.fieldI32(2, int32(len(page)))
+		header.fieldI32(3, int32(len(page)))
+		header.fieldStruct(5)
+		header.fieldI32(1, int32(rows))
+		header.fieldI32(2, parquetPlain)
+		header.fieldI32(3, parquetRLE)
+		header.fieldI32(4, parquetRLE)
+		header.structEnd()
+		header.structEnd()
+
+		chunk := parquetChunk{offset: p.w.n, values: int64(rows)}
+		if _, err := p.w.Write(header.buf.Bytes()); err != nil {
+			return fmt.Errorf("error writing Parquet page: %v", err)
+		}
+		if _, err := p.w.Write(page); err != nil {
+			return fmt.Errorf("error writing Parquet page: %v", err)
+		}
+		chunk.size = p.w.n - chunk.offset
+		group.size += chunk.size
+		group.chunks = append(group.chunks, chunk)
+		p.values[i] = p.values[i][:0]
+	}
+	p.rowGroups = append(p.rowGroups, group)
+	p.rows += int64(rows)
+	return nil
+}
+
+// Close writes the last row group and the footer.
+func (p *parquetWriter) Close() error {
+	if p.err != nil {
+		return p.err
+	}
+	if err := p.flush(); err != nil {
+		return err
+	}
+
+	var meta thriftWriter
+	meta.fieldI32(1, 1) // version
+	meta.fieldList(2, thriftStruct, len(p.columns)+1)
+	meta.structBegin()
+	meta.fieldBinary(4, "schema")
+	meta.fieldI32(5, int32(len(p.columns)))
+	meta.structEnd()
+	for _, column := range p.columns {
+		physical, converted := parquetType(column.kind)
+		repetition := int32(parquetRequired)
+		if column.kind == exportTime {
+			repetition = parquetOptional
+		}
+		meta.structBegin()
+		meta.fieldI32(1, physical)
+		meta.fieldI32(3, repetition)
+		meta.fieldBinary(4, column.name)
+		if converted >= 0 {
+			meta.fieldI32(6, converted)
+		}
+		meta.structEnd()
+	}
+	meta.fieldI64(3, p.rows)
+	meta.fieldList(4, thriftStruct, len(p.rowGroups))
+	for _, group := range p.rowGroups {
+		meta.structBegin()
+		meta.fieldList(1, thriftStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			physical, _ := parquetType(p.columns[i].kind)
+			meta.structBegin()
+			meta.fieldI64(2, chunk.offset)
+			meta.fieldStruct(3)
+			meta.fieldI32(1, physical)
+			meta.fieldList(2, thriftI32, 2)
+			meta.i32(parquetPlain)
+			meta.i32(parquetRLE)
+			meta.fieldList(3, thriftBinary, 1)
+			meta.binary(p.columns[i].name)
+			meta.fieldI32(4, 0) // UNCOMPRESSED
+			meta.fieldI64(5, chunk.values)
+			meta.fieldI64(6, chunk.size)
+			meta.fieldI64(7, chunk.size)
+			meta.fieldI64(9, chunk.offset)
+			meta.structEnd()
+			meta.structEnd()
+		}
+		meta.fieldI64(2, group.size)
+		meta.fieldI64(3, group.rows)
+		meta.structEnd()
+	}
+	meta.fieldBinary(6, "file_scanner")
+	meta.structEnd()
+
+	footer := meta.buf.Bytes()
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	footer = append(footer, parquetMagic...)
+	if _, err := p.w.Write(footer); err != nil {
+		return fmt.Errorf("error writing Parquet footer: %v", err)
+	}
+	return nil
+}
+
+// parquetType maps an export column kind to a physical type and a converted
+// type, or -1 for none. other_metadata is plain text, since catalogs written
+// before it held JSON have empty strings.
+func parquetType(kind int) (physical, converted int32) {
+	switch kind {
+	case exportInt32:
+		return parquetInt32, -1
+	case exportInt64:
+		return parquetInt64, -1
+	case exportBool:
+		return parquetBoolean, -1
+	case exportTime:
+		return parquetInt64, parquetTimestampMicros
+	default:
+		return parquetByteArray, parquetUTF8
+	}
+}
+
+// parquetPage encodes the values of a column as the body of a data page:
+// definition levels for optional columns, then the non-null values.
+func parquetPage(column exportColumn, values []interface{}) []byte {
+	var page bytes.Buffer
+	if column.kind == exportTime {
+		// Definition levels are one bit each, as a single bit-packed run of
+		// the RLE/bit-packing hybrid, after the run's length.
+		levels := make([]byte, (len(values)+7)/8)
+		for i, value := range values {
+			if !value.(time.Time).IsZero() {
+				levels[i/8] |= 1 << (i % 8)
+			}
+		}
+		run := binary.AppendUvarint(nil, uint64(len(levels))<<1|1)
+		run = append(run, levels...)
+		page.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(run))))
+		page.Write(run)
+	}
+
+	switch column.kind {
+	case exportBool:
+		bits := make([]byte, (len(values)+7)/8)
+		for i, value := range values {
+			if value.(bool) {
+				bits[i/8] |= 1 << (i % 8)
+			}
+		}
+		page.Write(bits)
+	case exportInt32:
+		for _, value := range values {
+			binary.Write(&page, binary.LittleEndian, value.(int32))
+		}
+	case exportInt64:
+		for _, value := range values {
+			binary.Write(&page, binary.LittleEndian, value.(int64))
+		}
+	case exportTime:
+		for _, value := range values {
+			if t := value.(time.Time); !t.IsZero() {
+				binary.Write(&page, binary.LittleEndian, t.UnixMicro())
+			}
+		}
+	default:
+		for _, value := range values {
+			s := value.(string)
+			binary.Write(&page, binary.LittleEndian, uint32(len(s)))
+			page.WriteString(s)
+		}
+	}
+	return page.Bytes()
+}
+
+// Thrift compact protocol type codes.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs in the Thrift compact protocol, which the
+// Parquet page headers and footer use. Fields must be written in order of
+// their IDs within each struct.
+type thriftWriter struct {
+	buf    bytes.Buffer
+	lastID int16
+	stack  []int16
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if delta := id - t.lastID; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(int64(id))
+	}
+	t.lastID = id
+}
+
+// varint writes a zigzag-encoded variable-length integer.
+func (t *thriftWriter) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+func (t *thriftWriter) i32(v int32) { t.varint(int64(v)) }
+
+func (t *thriftWriter) binary(s string) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutUvarint(b[:], uint64(len(s)))])
+	t.buf.WriteString(s)
+}
+
+func (t *thriftWriter) fieldI32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) fieldI64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) fieldBinary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.binary(s)
+}
+
+// fieldList starts a list field; the elements are written next.
+func (t *thriftWriter) fieldList(id int16, elemType byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elemType)
+		return
+	}
+	t.buf.WriteByte(0xF0 | elemType)
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutUvarint(b[:], uint64(size))])
+}
+
+// fieldStruct starts a struct field, ended by structEnd.
+func (t *thriftWriter) fieldStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.structBegin()
+}
+
+// structBegin starts a struct that is a list element.
+func (t *thriftWriter) structBegin() {
+	t.stack = append(t.stack, t.lastID)
+	t.lastID = 0
+}
+
+// structEnd ends the current struct. A top-level struct has no matching
+// structBegin.
+func (t *thriftWriter) structEnd() {
+	t.buf.WriteByte(0)
+	if n := len(t.stack); n > 0 {
+		t.lastID = t.stack[n-1]
+		t.stack = t.stack[:n-1]
+	}
+}
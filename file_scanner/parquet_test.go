@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// thriftReader decodes Thrift compact protocol structs into maps from field
+// ID to value: int64 for integers, string for binary, []interface{} for
+// lists and map[int16]interface{} for structs.
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.data) {
+		panic(fmt.Sprintf("thrift data ends at %d", r.pos))
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		panic(fmt.Sprintf("bad varint at %d", r.pos))
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	v, n := binary.Varint(r.data[r.pos:])
+	if n <= 0 {
+		panic(fmt.Sprintf("bad varint at %d", r.pos))
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		size := int(r.uvarint())
+		if r.pos+size > len(r.data) {
+			panic(fmt.Sprintf("binary of %d bytes at %d runs past the end", size, r.pos))
+		}
+		s := string(r.data[r.pos : r.pos+size])
+		r.pos += size
+		return s
+	case thriftList:
+		header := r.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = r.value(header & 0x0F)
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	}
+	panic(fmt.Sprintf("unknown thrift type %d at %d", typ, r.pos))
+}
+
+func (r *thriftReader) structure() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var id int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.varint())
+		}
+		fields[id] = r.value(header & 0x0F)
+	}
+}
+
+// readThrift decodes the struct at the start of data and returns it with
+// the number of bytes it took.
+func readThrift(t *testing.T, data []byte) (fields map[int16]interface{}, size int) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("error decoding thrift: %v", r)
+		}
+	}()
+	r := &thriftReader{data: data}
+	return r.structure(), r.pos
+}
+
+func TestParquetWriterRoundTrip(t *testing.T) {
+	// Three row groups, the last one partial, with every third file never
+	// seen so that last_seen holds nulls.
+	const rows = 2*parquetRowGroupSize + 5
+	modTime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local)
+	seenAt := time.Date(2024, 6, 1, 0, 0, 0, 123000, time.UTC)
+	files := make([]FileInfo, rows)
+	for i := range files {
+		files[i] = FileInfo{
+			FileName: fmt.Sprintf("file%d.txt", i),
+			FilePath: fmt.Sprintf("/data/file%d.txt", i),
+			FileSize: int64(i) * 3,
+			ModTime:  modTime,
+			Depth:    2,
+		}
+		if i%3 != 0 {
+			files[i].LastSeen = seenAt.Add(time.Duration(i) * time.Second)
+		}
+	}
+
+	var out bytes.Buffer
+	writer := newParquetWriter(&out, exportColumns)
+	for _, file := range files {
+		if err := writer.Write(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := out.Bytes()
+
+	if !bytes.HasPrefix(data, parquetMagic) || !bytes.HasSuffix(data, parquetMagic) {
+		t.Fatalf("file does not start and end with %q", parquetMagic)
+	}
+	footerLength := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footerStart := len(data) - 8 - footerLength
+	if footerStart < len(parquetMagic) {
+		t.Fatalf("footer length %d is longer than the file", footerLength)
+	}
+	meta, size := readThrift(t, data[footerStart:len(data)-8])
+	if size != footerLength {
+		t.Fatalf("FileMetaData takes %d bytes, footer length says %d", size, footerLength)
+	}
+
+	if meta[1] != int64(1) {
+		t.Errorf("version is %v, want 1", meta[1])
+	}
+	if meta[3] != int64(rows) {
+		t.Errorf("num_rows is %v, want %d", meta[3], rows)
+	}
+
+	schema := meta[2].([]interface{})
+	if len(schema) != len(exportColumns)+1 {
+		t.Fatalf("schema has %d elements, want %d", len(schema), len(exportColumns)+1)
+	}
+	root := schema[0].(map[int16]interface{})
+	if root[4] != "schema" || root[5] != int64(len(exportColumns)) {
+		t.Errorf("schema root is %v, want \"schema\" with %d children", root, len(exportColumns))
+	}
+	for i, column := range exportColumns {
+		element := schema[i+1].(map[int16]interface{})
+		physical, converted := parquetType(column.kind)
+		repetition := int64(parquetRequired)
+		if column.kind == exportTime {
+			repetition = parquetOptional
+		}
+		if element[4] != column.name || element[1] != int64(physical) || element[3] != repetition {
+			t.Errorf("schema element %d is %v, want %s of type %d, repetition %d", i+1, element, column.name, physical, repetition)
+		}
+		if converted >= 0 && element[6] != int64(converted) {
+			t.Errorf("column %s has converted type %v, want %d", column.name, element[6], converted)
+		}
+	}
+
+	groups := meta[4].([]interface{})
+	wantRows := []int64{parquetRowGroupSize, parquetRowGroupSize, 5}
+	if len(groups) != len(wantRows) {
+		t.Fatalf("%d row groups, want %d", len(groups), len(wantRows))
+	}
+	first := 0
+	for g, value := range groups {
+		group := value.(map[int16]interface{})
+		if group[3] != wantRows[g] {
+			t.Errorf("row group %d has %v rows, want %d", g, group[3], wantRows[g])
+		}
+		chunks := group[1].([]interface{})
+		if len(chunks) != len(exportColumns) {
+			t.Fatalf("row group %d has %d column chunks, want %d", g, len(chunks), len(exportColumns))
+		}
+		var groupSize int64
+		for i, column := range exportColumns {
+			chunk := chunks[i].(map[int16]interface{})
+			chunkMeta := chunk[3].(map[int16]interface{})
+			if path := chunkMeta[3].([]interface{}); len(path) != 1 || path[0] != column.name {
+				t.Errorf("row group %d chunk %d has path %v, want %s", g, i, path, column.name)
+			}
+			if chunkMeta[5] != wantRows[g] {
+				t.Errorf("row group %d column %s has %v values, want %d", g, column.name, chunkMeta[5], wantRows[g])
+			}
+			offset, chunkSize := chunkMeta[9].(int64), chunkMeta[7].(int64)
+			if chunk[2] != offset {
+				t.Errorf("row group %d column %s: file_offset %v, data_page_offset %d", g, column.name, chunk[2], offset)
+			}
+			groupSize += chunkSize
+
+			header, headerSize := readThrift(t, data[offset:])
+			pageSize := header[3].(int64)
+			if header[1] != int64(0) || header[2] != pageSize {
+				t.Errorf("row group %d column %s has page header %v, want an uncompressed data page", g, column.name, header)
+			}
+			if int64(headerSize)+pageSize != chunkSize {
+				t.Errorf("row group %d column %s: page of %d bytes after a %d byte header, chunk of %d", g, column.name, pageSize, headerSize, chunkSize)
+			}
+			if pageHeader := header[5].(map[int16]interface{}); pageHeader[1] != wantRows[g] {
+				t.Errorf("row group %d column %s page has %v values, want %d", g, column.name, pageHeader[1], wantRows[g])
+			}
+			page := data[offset+int64(headerSize) : offset+chunkSize]
+			switch column.name {
+			case "file_size":
+				checkInt64Page(t, page, files[first:first+int(wantRows[g])])
+			case "last_seen":
+				checkTimestampPage(t, page, files[first:first+int(wantRows[g])])
+			}
+		}
+		if group[2] != groupSize {
+			t.Errorf("row group %d has total_byte_size %v, its chunks add up to %d", g, group[2], groupSize)
+		}
+		first += int(wantRows[g])
+	}
+}
+
+// checkInt64Page compares a required INT64 page with the file sizes.
+func checkInt64Page(t *testing.T, page []byte, files []FileInfo) {
+	t.Helper()
+	if len(page) != 8*len(files) {
+		t.Fatalf("file_size page has %d bytes, want %d", len(page), 8*len(files))
+	}
+	for i, file := range files {
+		if got := int64(binary.LittleEndian.Uint64(page[8*i:])); got != file.FileSize {
+			t.Fatalf("file_size %d is %d, want %d", i, got, file.FileSize)
+		}
+	}
+}
+
+// checkTimestampPage decodes an optional timestamp page, its definition
+// levels then the non-null values, and compares it with last_seen.
+func checkTimestampPage(t *testing.T, page []byte, files []FileInfo) {
+	t.Helper()
+	levelsSize := int(binary.LittleEndian.Uint32(page))
+	levels := page[4 : 4+levelsSize]
+	runHeader, n := binary.Uvarint(levels)
+	if runHeader&1 != 1 || int(runHeader>>1) != (len(files)+7)/8 {
+		t.Fatalf("definition levels have run header %d, want a bit-packed run of %d groups", runHeader, (len(files)+7)/8)
+	}
+	bits := levels[n:]
+	values := page[4+levelsSize:]
+	for i, file := range files {
+		defined := bits[i/8]&(1<<(i%8)) != 0
+		if defined != !file.LastSeen.IsZero() {
+			t.Fatalf("last_seen %d defined is %t, want %t", i, defined, !file.LastSeen.IsZero())
+		}
+		if !defined {
+			continue
+		}
+		if len(values) < 8 {
+			t.Fatalf("last_seen values end before row %d", i)
+		}
+		if got := int64(binary.LittleEndian.Uint64(values)); got != file.LastSeen.UnixMicro() {
+			t.Fatalf("last_seen %d is %d, want %d", i, got, file.LastSeen.UnixMicro())
+		}
+		values = values[8:]
+	}
+	if len(values) != 0 {
+		t.Fatalf("%d bytes left after the last_seen values", len(values))
+	}
+}
+
+func TestParquetWriterEmpty(t *testing.T) {
+	var out bytes.Buffer
+	writer := newParquetWriter(&out, exportColumns)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := out.Bytes()
+	footerLength := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if len(parquetMagic)+footerLength+8 != len(data) {
+		t.Fatalf("empty file of %d bytes has a footer of %d", len(data), footerLength)
+	}
+	meta, _ := readThrift(t, data[len(parquetMagic):len(data)-8])
+	if meta[3] != int64(0) || len(meta[4].([]interface{})) != 0 {
+		t.Errorf("empty file has num_rows %v and row groups %v, want none", meta[3], meta[4])
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// postgresBatchSize is much larger than batchSize because COPY has no limit
+// on parameters and its per-statement overhead is what dominates.
+const postgresBatchSize = 5000
+
+// postgresStorage keeps catalogs as tables in the current schema of a
+// PostgreSQL database. Batches are streamed with COPY into a temporary
+// staging table and merged from there in a single statement.
+type postgresStorage struct {
+	db *sql.DB
+}
+
+// PostgreSQL TLS modes, as lib/pq supports them.
+const (
+	sslDisable    = "disable"     // no TLS, for servers without it such as most local installs
+	sslRequire    = "require"     // TLS without checking the server certificate
+	sslVerifyCA   = "verify-ca"   // TLS with a server certificate signed by a trusted CA
+	sslVerifyFull = "verify-full" // verify-ca, and the certificate must name the server
+)
+
+var sslModes = []string{sslDisable, sslRequire, sslVerifyCA, sslVerifyFull}
+
+func openPostgresStorage(cfg ConnectionConfig) (Storage, error) {
+	port := cfg.Port
+	if port == "" {
+		port = "5432"
+	}
+	sslMode := cfg.SSLMode
+	if sslMode == "" {
+		sslMode = sslRequire
+	}
+	if !containsString(sslModes, sslMode) {
+		return nil, fmt.Errorf("unknown sslmode %q; use one of %s", sslMode, strings.Join(sslModes, ", "))
+	}
+
+	// A URL escapes passwords holding spaces, quotes or other characters
+	// that would end a key=value setting early.
+	connURL := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(cfg.Username, cfg.Password),
+		Host:   net.JoinHostPort(cfg.Server, port),
+		Path:   "/" + cfg.Database,
+		// Set even when it is the default, so the mode in use is never
+		// left to PGSSLMODE.
+		RawQuery: url.Values{"sslmode": {sslMode}}.Encode(),
+	}
+
+	db, err := sql.Open("postgres", connURL.String())
+	if err != nil {
+		return nil, fmt.Errorf("error opening database connection: %v", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error pinging database: %v", err)
+	}
+
+	log.Printf("Connected to PostgreSQL database '%s' on %s:%s", cfg.Database, cfg.Server, port)
+	return &postgresStorage{db: db}, nil
+}
+
+// postgresAddedColumns are added to tables created before they existed.
+var postgresAddedColumns = []addedColumn{
+	{"content_hash", "VARCHAR(80) NULL"},
+	{"last_seen", "TIMESTAMP(3) NULL"},
+	{"deleted_at", "TIMESTAMP(3) NULL"},
+	{"mime_type", "VARCHAR(100) NULL"},
+	{"mime_mismatch", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"parent_path_hash", "VARCHAR(64) NULL"},
+	{"is_dir", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"file_count", "BIGINT NOT NULL DEFAULT 0"},
+	{"depth", "INTEGER NULL"},
+}
+
+// postgresMaxIdentifierLength is the longest identifier PostgreSQL keeps.
+// It truncates longer ones, so two long names could name the same table.
+const postgresMaxIdentifierLength = 63
+
+// postgresTable validates a catalog name and quotes it for PostgreSQL.
+func postgresTable(name string) (string, error) {
+	table, err := parseCatalogTable(name, postgresMaxIdentifierLength)
+	if err != nil {
+		return "", err
+	}
+	return table.quoted(postgresQuote), nil
+}
+
+func (s *postgresStorage) CreateCatalog(name string) error {
+	table, err := parseCatalogTable(name, postgresMaxIdentifierLength)
+	if err != nil {
+		return err
+	}
+	tableName := table.quoted(postgresQuote)
+	query := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		id BIGSERIAL PRIMARY KEY,
+		file_name VARCHAR(255) NOT NULL,
+		file_path TEXT NULL,
+		path_hash VARCHAR(64) NOT NULL UNIQUE,
+		file_size BIGINT NOT NULL,
+		mod_time TIMESTAMP NOT NULL,
+		other_metadata TEXT NULL,
+		extension VARCHAR(50) NULL,
+		content_hash VARCHAR(80) NULL,
+		last_seen TIMESTAMP(3) NULL,
+		deleted_at TIMESTAMP(3) NULL,
+		mime_type VARCHAR(100) NULL,
+		mime_mismatch BOOLEAN NOT NULL DEFAULT FALSE,
+		parent_path_hash VARCHAR(64) NULL,
+		is_dir BOOLEAN NOT NULL DEFAULT FALSE,
+		file_count BIGINT NOT NULL DEFAULT 0,
+		depth INTEGER NULL
+	)`, tableName)
+
+	if _, err := s.db.Exec(query); err != nil {
+		return fmt.Errorf("error creating table: %v", err)
+	}
+
+	for _, column := range postgresAddedColumns {
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", tableName, column.name, column.definition)
+		if _, err := s.db.Exec(query); err != nil {
+			return fmt.Errorf("error adding column %s: %v", column.name, err)
+		}
+	}
+
+	// The index serves ListChildren and the joins of SubtreeTotals.
+	query = fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (parent_path_hash)", postgresQuote(table.parentIndex()), tableName)
+	if _, err := s.db.Exec(query); err != nil {
+		return fmt.Errorf("error creating parent index: %v", err)
+	}
+
+	log.Printf("Table '%s' created or already exists", name)
+	return nil
+}
+
+// ListCatalogs lists the tables of the database outside the system schemas,
+// qualified with their schema unless it is the current one.
+func (s *postgresStorage) ListCatalogs() ([]string, error) {
+	rows, err := s.db.Query(`SELECT CASE WHEN table_schema = current_schema() THEN table_name
+			ELSE table_schema || '.' || table_name END AS name
+		FROM information_schema.tables
+		WHERE table_schema NOT IN ('pg_catalog', 'information_schema') AND table_type = 'BASE TABLE'
+		ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tables: %v", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	var tableName string
+	for rows.Next() {
+		if err := rows.Scan(&tableName); err != nil {
+			return nil, fmt.Errorf("error scanning table name: %v", err)
+		}
+		tables = append(tables, tableName)
+	}
+	return tables, rows.Err()
+}
+
+func (s *postgresStorage) LookupFiles(name string, pathHashes []string) (map[string]FileState, error) {
+	table, err := postgresTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return queryFileStates(s.db, table, pathHashes, func(i int) string { return fmt.Sprintf("$%d", i) })
+}
+
+func (s *postgresStorage) TouchFiles(name string, pathHashes []string, seenAt time.Time) error {
+	table, err := postgresTable(name)
+	if err != nil {
+		return err
+	}
+	return touchFileRows(s.db, table, pathHashes, seenAt, func(i int) string { return fmt.Sprintf("$%d", i) })
+}
+
+func (s *postgresStorage) MarkUnseen(name, rootPath string, seenAt time.Time, purge bool) (DeletionSummary, error) {
+	table, err := postgresTable(name)
+	if err != nil {
+		return DeletionSummary{}, err
+	}
+	return markUnseenRows(s.db, table, rootPath, seenAt, purge, func(i int) string { return fmt.Sprintf("$%d", i) })
+}
+
+func (s *postgresStorage) MarkDeleted(name string, paths []string, purge bool) (DeletionSummary, error) {
+	table, err := postgresTable(name)
+	if err != nil {
+		return DeletionSummary{}, err
+	}
+	return markDeletedRows(s.db, table, paths, purge, func(i int) string { return fmt.Sprintf("$%d", i) })
+}
+
+func (s *postgresStorage) ListChildren(name, path string) ([]FileInfo, error) {
+	table, err := postgresTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return listChildren(s.db, table, path, func(i int) string { return fmt.Sprintf("$%d", i) })
+}
+
+func (s *postgresStorage) SubtreeTotals(name, path string) (int64, int64, error) {
+	table, err := postgresTable(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	return subtreeTotals(s.db, table, path, "WITH RECURSIVE", "", func(i int) string { return fmt.Sprintf("$%d", i) })
+}
+
+// postgresOwner reads the owner name from other_metadata, falling back to
+// the numeric uid. Rows written before metadata was JSON hold an empty
+// string, which jsonb would reject.
+const postgresOwner = `CASE WHEN other_metadata LIKE '{%'
+	THEN COALESCE(other_metadata::jsonb ->> 'owner', other_metadata::jsonb ->> 'uid') END`
+
+func (s *postgresStorage) UsageBreakdown(name, path, by string) ([]UsageGroup, error) {
+	table, err := postgresTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return usageBreakdown(s.db, table, path, by, postgresOwner, func(i int) string { return fmt.Sprintf("$%d", i) })
+}
+
+func (s *postgresStorage) SearchFiles(name string, query FileQuery) ([]FileInfo, int64, error) {
+	table, err := postgresTable(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	return searchFiles(s.db, table, query, offsetFetch, func(i int) string { return fmt.Sprintf("$%d", i) })
+}
+
+func (s *postgresStorage) StreamFiles(name, root string, fn func(FileInfo) error) error {
+	table, err := postgresTable(name)
+	if err != nil {
+		return err
+	}
+	return streamFiles(s.db, table, root, fn, func(i int) string { return fmt.Sprintf("$%d", i) })
+}
+
+func (s *postgresStorage) SizeCollisions(name string) ([]FileInfo, error) {
+	table, err := postgresTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return querySizeCollisions(s.db, table)
+}
+
+func (s *postgresStorage) BatchSize() int {
+	return postgresBatchSize
+}
+
+func (s *postgresStorage) UpsertBatch(name string, files []FileInfo) error {
+	if len(files) == 0 {
+		return nil
+	}
+	table, err := postgresTable(name)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// The staging table copies the catalog's column types without its
+	// constraints or identity, and disappears with the transaction.
+	_, err = tx.Exec(fmt.Sprintf(`
+	CREATE TEMP TABLE file_scanner_staging ON COMMIT DROP AS
+	SELECT %s FROM %s WITH NO DATA`, strings.Join(fileColumns, ", "), table))
+	if err != nil {
+		return fmt.Errorf("error creating staging table: %v", err)
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("file_scanner_staging", fileColumns...))
+	if err != nil {
+		return fmt.Errorf("error starting copy: %v", err)
+	}
+	for _, file := range files {
+		if _, err := stmt.Exec(fileValues(file)...); err != nil {
+			stmt.Close()
+			return fmt.Errorf("error copying %s: %v", file.FilePath, err)
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return fmt.Errorf("error flushing copy: %v", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return fmt.Errorf("error finishing copy: %v", err)
+	}
+
+	// DISTINCT ON guards against the same path twice in one batch, which
+	// ON CONFLICT would otherwise reject.
+	columns := strings.Join(fileColumns, ", ")
+	_, err = tx.Exec(fmt.Sprintf(`
+	INSERT INTO %s (%s)
+	SELECT DISTINCT ON (path_hash) %s
+	FROM file_scanner_staging
+	ON CONFLICT (path_hash) DO UPDATE SET
+		%s`, table, columns, columns, upsertAssignments("EXCLUDED")))
+	if err != nil {
+		return fmt.Errorf("error merging staged files: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing batch: %v", err)
+	}
+
+	log.Printf("Successfully upserted %d files into the PostgreSQL database", len(files))
+	return nil
+}
+
+// Finalize refreshes the planner statistics, which a large bulk load leaves
+// badly out of date.
+func (s *postgresStorage) Finalize(name string) error {
+	table, err := postgresTable(name)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(fmt.Sprintf("ANALYZE %s", table)); err != nil {
+		return fmt.Errorf("error analyzing table: %v", err)
+	}
+	return nil
+}
+
+func (s *postgresStorage) Close() error {
+	return s.db.Close()
+}
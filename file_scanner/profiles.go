@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// profileFile is what profiles.gob holds: named connections, each the
+// settings saveCredentials writes, and the one used last.
+type profileFile struct {
+	Current  string
+	Profiles map[string]map[string]string
+}
+
+// defaultProfile names the connection of a single credentials.gob from
+// before profiles existed, and the profile saved when none is picked.
+const defaultProfile = "default"
+
+// profileExportKeys are the settings exportProfiles writes. Passwords and
+// the way they are kept are left out.
+var profileExportKeys = []string{
+	"backend", "ip", "port", "username", "dbname",
+	"file_format", "compression", "rotate_size",
+	"auth", "realm", "krb5_config", "keytab", "tenant_id",
+	"encrypt", "trust_server_cert", "tls_ca", "tls_hostname", "tls_pin",
+	"sslmode",
+}
+
+func getProfilesPath() (string, error) {
+	appDataDir, err := getAppDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appDataDir, "profiles.gob"), nil
+}
+
+// readProfiles loads the saved profiles. A credentials.gob written before
+// profiles existed becomes the default profile, with its password moved to
+// the keyring, and is removed.
+func readProfiles() (profileFile, error) {
+	profiles := profileFile{Profiles: make(map[string]map[string]string)}
+	profilesPath, err := getProfilesPath()
+	if err != nil {
+		return profiles, fmt.Errorf("error getting app data directory: %v", err)
+	}
+
+	file, err := os.Open(profilesPath)
+	if os.IsNotExist(err) {
+		return migrateCredentials(profiles)
+	}
+	if err != nil {
+		return profiles, fmt.Errorf("error opening profiles file: %v", err)
+	}
+	defer file.Close()
+
+	decoder := gob.NewDecoder(file)
+	if err := decoder.Decode(&profiles); err != nil {
+		return profiles, fmt.Errorf("error decoding profiles: %v", err)
+	}
+	if profiles.Profiles == nil {
+		profiles.Profiles = make(map[string]map[string]string)
+	}
+	return profiles, nil
+}
+
+func migrateCredentials(profiles profileFile) (profileFile, error) {
+	appDataDir, err := getAppDataDir()
+	if err != nil {
+		return profiles, fmt.Errorf("error getting app data directory: %v", err)
+	}
+	credentialsPath := filepath.Join(appDataDir, "credentials.gob")
+
+	file, err := os.Open(credentialsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return profiles, nil // It's okay if neither file exists
+		}
+		return profiles, fmt.Errorf("error opening credentials file: %v", err)
+	}
+	credentials := make(map[string]string)
+	err = gob.NewDecoder(file).Decode(&credentials)
+	file.Close()
+	if err != nil {
+		return profiles, fmt.Errorf("error decoding credentials: %v", err)
+	}
+
+	// The password moves to the keyring; the profiles file never holds it
+	// in plain text.
+	passwordStore := movePlaintextPassword(defaultProfile, credentials, "")
+	profiles.Current = defaultProfile
+	profiles.Profiles[defaultProfile] = credentials
+	if err := writeProfiles(profiles); err != nil {
+		return profiles, err
+	}
+	if err := os.Remove(credentialsPath); err != nil {
+		log.Printf("Error removing old credentials file: %v", err)
+		// At least don't leave the password behind in it.
+		if err := os.Truncate(credentialsPath, 0); err != nil {
+			log.Printf("Error clearing old credentials file: %v", err)
+		}
+	}
+	log.Printf("Moved saved credentials to profile %q, password store %q", defaultProfile, passwordStore)
+	return profiles, nil
+}
+
+// writeProfiles saves the profiles, readable only by the user.
+func writeProfiles(profiles profileFile) error {
+	profilesPath, err := getProfilesPath()
+	if err != nil {
+		return fmt.Errorf("error getting app data directory: %v", err)
+	}
+	file, err := os.OpenFile(profilesPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating profiles file: %v", err)
+	}
+	defer file.Close()
+
+	encoder := gob.NewEncoder(file)
+	if err := encoder.Encode(profiles); err != nil {
+		return fmt.Errorf("error encoding profiles: %v", err)
+	}
+	return nil
+}
+
+// checkProfileName rejects names that cannot be told apart in the picker.
+func checkProfileName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("profile name cannot be empty")
+	}
+	if name != strings.TrimSpace(name) {
+		return fmt.Errorf("profile name cannot start or end with spaces")
+	}
+	return nil
+}
+
+// listProfiles returns the names of the saved profiles in order and the
+// one used last.
+func listProfiles() ([]string, string, error) {
+	profiles, err := readProfiles()
+	if err != nil {
+		return nil, "", err
+	}
+	names := make([]string, 0, len(profiles.Profiles))
+	for name := range profiles.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, profiles.Current, nil
+}
+
+// renameProfile renames a profile, moving its password in the keyring.
+func renameProfile(oldName, newName string) error {
+	if err := checkProfileName(newName); err != nil {
+		return err
+	}
+	profiles, err := readProfiles()
+	if err != nil {
+		return err
+	}
+	settings, ok := profiles.Profiles[oldName]
+	if !ok {
+		return fmt.Errorf("no profile named %q", oldName)
+	}
+	if _, exists := profiles.Profiles[newName]; exists {
+		return fmt.Errorf("a profile named %q already exists", newName)
+	}
+
+	if settings["password_store"] == passwordKeyring {
+		password, err := passwordKeyringStore.Get(oldName)
+		if err != nil {
+			return err
+		}
+		if err := passwordKeyringStore.Set(newName, password); err != nil {
+			return err
+		}
+	}
+	delete(profiles.Profiles, oldName)
+	profiles.Profiles[newName] = settings
+	if profiles.Current == oldName {
+		profiles.Current = newName
+	}
+	if err := writeProfiles(profiles); err != nil {
+		return err
+	}
+	if err := passwordKeyringStore.Delete(oldName); err != nil {
+		log.Printf("Error removing saved password: %v", err)
+	}
+	return nil
+}
+
+// deleteProfile removes a profile and its password in the keyring.
+func deleteProfile(name string) error {
+	profiles, err := readProfiles()
+	if err != nil {
+		return err
+	}
+	if _, ok := profiles.Profiles[name]; !ok {
+		return fmt.Errorf("no profile named %q", name)
+	}
+	delete(profiles.Profiles, name)
+	if profiles.Current == name {
+		profiles.Current = ""
+	}
+	if err := writeProfiles(profiles); err != nil {
+		return err
+	}
+	// The profile is gone either way; a password left in the keyring is
+	// replaced if a profile of the same name is saved again.
+	if err := passwordKeyringStore.Delete(name); err != nil {
+		log.Printf("Error removing saved password: %v", err)
+	}
+	return nil
+}
+
+// exportProfiles writes the profiles as JSON, an object of settings by
+// profile name, without their passwords.
+func exportProfiles(w io.Writer) error {
+	profiles, err := readProfiles()
+	if err != nil {
+		return err
+	}
+	exported := make(map[string]map[string]string, len(profiles.Profiles))
+	for name, settings := range profiles.Profiles {
+		kept := make(map[string]string)
+		for _, key := range profileExportKeys {
+			if value, ok := settings[key]; ok {
+				kept[key] = value
+			}
+		}
+		exported[name] = kept
+	}
+	data, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding profiles: %v", err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing profiles: %v", err)
+	}
+	return nil
+}
+
+// importProfiles reads profiles written by exportProfiles and returns their
+// names. A profile that already exists has its settings replaced, and keeps
+// its password only if it still connects to the same server as the same
+// user; new ones have none saved. Unknown settings are ignored.
+func importProfiles(r io.Reader) ([]string, error) {
+	var imported map[string]map[string]string
+	if err := json.NewDecoder(r).Decode(&imported); err != nil {
+		return nil, fmt.Errorf("error reading profiles: %v", err)
+	}
+	profiles, err := readProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(imported))
+	for name, settings := range imported {
+		if err := checkProfileName(name); err != nil {
+			return nil, fmt.Errorf("%v: %q", err, name)
+		}
+		profile, ok := profiles.Profiles[name]
+		if !ok {
+			profile = map[string]string{"password_store": passwordNone}
+			profiles.Profiles[name] = profile
+		} else if !sameServer(profile, settings) {
+			// Don't send the saved password to a server it was not
+			// meant for.
+			profile["password_store"] = passwordNone
+			delete(profile, "vault_salt")
+			delete(profile, "vault_password")
+			if err := passwordKeyringStore.Delete(name); err != nil {
+				log.Printf("Error removing saved password: %v", err)
+			}
+		}
+		for _, key := range profileExportKeys {
+			if value, ok := settings[key]; ok {
+				profile[key] = value
+			} else {
+				delete(profile, key)
+			}
+		}
+		names = append(names, name)
+	}
+	if err := writeProfiles(profiles); err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// sameServer reports whether two profiles log in to the same server as the
+// same user.
+func sameServer(a, b map[string]string) bool {
+	for _, key := range []string{"backend", "ip", "port", "username"} {
+		if a[key] != b[key] {
+			return false
+		}
+	}
+	return true
+}
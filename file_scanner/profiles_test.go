@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeLegacyCredentials writes a credentials.gob as versions before
+// profiles saved it.
+func writeLegacyCredentials(t *testing.T, appData string, credentials map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(appData, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(filepath.Join(appData, "credentials.gob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := gob.NewEncoder(file).Encode(credentials); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateCredentials(t *testing.T) {
+	tests := []struct {
+		name         string
+		keyring      secretStore
+		wantStore    string
+		wantPassword string
+	}{
+		{"to the keyring", &memoryKeyring{passwords: make(map[string]string)}, passwordKeyring, "legacy;pw"},
+		{"dropped without a keyring", unavailableKeyring{}, passwordNone, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			appData := useTestAppData(t)
+			useTestKeyring(t, test.keyring)
+			writeLegacyCredentials(t, appData, map[string]string{
+				"ip": "db.example.com", "port": "1433", "username": "scanner", "password": "legacy;pw", "dbname": "inventory",
+			})
+
+			names, current, err := listProfiles()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(names) != 1 || names[0] != defaultProfile || current != defaultProfile {
+				t.Fatalf("profiles %v, current %q; want only %q", names, current, defaultProfile)
+			}
+			if _, err := os.Stat(filepath.Join(appData, "credentials.gob")); !os.IsNotExist(err) {
+				t.Errorf("credentials.gob was not removed: %v", err)
+			}
+			data, err := os.ReadFile(filepath.Join(appData, "profiles.gob"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(data), "legacy;pw") {
+				t.Fatalf("profiles.gob holds the password in plain text")
+			}
+
+			cfg, passwordStore, err := loadCredentials(defaultProfile, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if passwordStore != test.wantStore || cfg.Password != test.wantPassword {
+				t.Errorf("loaded password %q from %q, want %q from %q", cfg.Password, passwordStore, test.wantPassword, test.wantStore)
+			}
+			if cfg.Server != "db.example.com" || cfg.Username != "scanner" || cfg.Database != "inventory" {
+				t.Errorf("loaded %+v, want the legacy settings", cfg)
+			}
+		})
+	}
+}
+
+func TestDeleteProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyring secretStore
+	}{
+		{"with a keyring", &memoryKeyring{passwords: make(map[string]string)}},
+		{"without a keyring", unavailableKeyring{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestAppData(t)
+			useTestKeyring(t, test.keyring)
+			cfg := ConnectionConfig{Backend: "mssql", Server: "db", Username: "scanner"}
+			if err := saveCredentials("staging", cfg, passwordNone, ""); err != nil {
+				t.Fatal(err)
+			}
+			if err := deleteProfile("staging"); err != nil {
+				t.Fatalf("deleteProfile: %v", err)
+			}
+			names, current, err := listProfiles()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(names) != 0 || current != "" {
+				t.Errorf("after deleting, profiles %v, current %q; want none", names, current)
+			}
+			if err := deleteProfile("staging"); err == nil {
+				t.Errorf("deleting a missing profile succeeded")
+			}
+		})
+	}
+}
+
+func TestImportProfilesDropsPasswordForAnotherServer(t *testing.T) {
+	tests := []struct {
+		name         string
+		store        string
+		imported     string
+		wantPassword string
+	}{
+		{"same server from the keyring", passwordKeyring, `"ip": "db1", "username": "scanner", "dbname": "archive"`, "pw"},
+		{"same server from the vault", passwordVault, `"ip": "db1", "username": "scanner", "dbname": "archive"`, "pw"},
+		{"other server from the keyring", passwordKeyring, `"ip": "evil.example.com", "username": "scanner"`, ""},
+		{"other server from the vault", passwordVault, `"ip": "evil.example.com", "username": "scanner"`, ""},
+		{"other port", passwordKeyring, `"ip": "db1", "port": "1434", "username": "scanner"`, ""},
+		{"other user", passwordKeyring, `"ip": "db1", "username": "admin"`, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			appData := useTestAppData(t)
+			keyring := &memoryKeyring{passwords: make(map[string]string)}
+			useTestKeyring(t, keyring)
+			cfg := ConnectionConfig{Backend: "mssql", Server: "db1", Username: "scanner", Password: "pw", Database: "inventory"}
+			if err := saveCredentials("work", cfg, test.store, "master"); err != nil {
+				t.Fatal(err)
+			}
+
+			input := `{"work": {"backend": "mssql", ` + test.imported + `}}`
+			if _, err := importProfiles(strings.NewReader(input)); err != nil {
+				t.Fatal(err)
+			}
+			loaded, _, err := loadCredentials("work", "master")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.Password != test.wantPassword {
+				t.Errorf("loaded password %q, want %q", loaded.Password, test.wantPassword)
+			}
+			if test.wantPassword != "" {
+				return
+			}
+			if _, ok := keyring.passwords["work"]; ok {
+				t.Errorf("the keyring still holds the password")
+			}
+			data, err := os.ReadFile(filepath.Join(appData, "profiles.gob"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(data), "vault_password") {
+				t.Errorf("profiles.gob still holds the sealed password")
+			}
+		})
+	}
+}
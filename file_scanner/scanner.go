@@ -2,9 +2,7 @@ package main
 
 import (
 	"context"
-	"crypto/sha256"
-	"database/sql"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
@@ -16,12 +14,17 @@ import (
 )
 
 var (
-	totalFilesScanned int64
-	totalFilesWritten int64
-	scanStartTime     time.Time
-	lastUpdateTime    time.Time
-	lastFilesScanned  int64
-	lastFilesWritten  int64
+	totalFilesScanned   int64
+	totalFilesWritten   int64
+	totalFilesNew       int64
+	totalFilesChanged   int64
+	totalFilesUnchanged int64
+	totalFilesDeleted   int64
+	totalBytesDeleted   int64
+	scanStartTime       time.Time
+	lastUpdateTime      time.Time
+	lastFilesScanned    int64
+	lastFilesWritten    int64
 )
 
 const (
@@ -29,21 +32,85 @@ const (
 	numWorkers = 10
 )
 
-func scanFolder(ctx context.Context, db *sql.DB, tableName, folderPath string) error {
+// ScanOptions are the per-scan settings chosen in the GUI or on the command
+// line. The zero value is a plain metadata scan.
+type ScanOptions struct {
+	// HashAlgorithm enables content hashing when set to one of
+	// hashAlgorithms.
+	HashAlgorithm string
+	// HashRateLimit caps the bytes per second read by all workers together
+	// while hashing. Zero means unlimited.
+	HashRateLimit int64
+	// Incremental only writes files that are new or whose size or
+	// modification time differ from the catalog. Content is only hashed
+	// for those files.
+	Incremental bool
+	// PurgeDeleted deletes the rows of files a completed scan no longer
+	// finds instead of setting their deleted_at.
+	PurgeDeleted bool
+	// Filters limit which files are recorded.
+	Filters FilterRules
+	// ExtractContent runs the registered content extractors and stores
+	// their results in other_metadata. See extractors.go.
+	ExtractContent bool
+	// DetectMIME sniffs each file's type from its first bytes into
+	// mime_type and flags files whose extension disagrees.
+	DetectMIME bool
+}
+
+// scanFolder walks folderPath and writes every file the filter rules allow
+// to the catalog, followed by a row for every directory it entered with the
+// count and total size of those files below it. When the backend can track
+// changes, no filters are set and the walk covered the whole folder without
+// errors, rows under folderPath that were not found are then marked as
+// deleted, or purged.
+func scanFolder(ctx context.Context, store Storage, tableName, folderPath string, opts ScanOptions) error {
+	if err := validateHashAlgorithm(opts.HashAlgorithm); err != nil {
+		return err
+	}
+	if err := opts.Filters.validate(); err != nil {
+		return err
+	}
+	if _, ok := store.(ChangeTracker); opts.Incremental && !ok {
+		return fmt.Errorf("this storage backend does not support incremental scans")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	fileChan := make(chan string, 10000)
 	resultChan := make(chan FileInfo, 10000)
-	errChan := make(chan error, 1)
+	errChan := make(chan error, 2)
+	writeDone := make(chan struct{})
 	var wg sync.WaitGroup
 
 	// Reset counters
 	atomic.StoreInt64(&totalFilesScanned, 0)
 	atomic.StoreInt64(&totalFilesWritten, 0)
+	atomic.StoreInt64(&totalFilesNew, 0)
+	atomic.StoreInt64(&totalFilesChanged, 0)
+	atomic.StoreInt64(&totalFilesUnchanged, 0)
+	atomic.StoreInt64(&totalFilesDeleted, 0)
+	atomic.StoreInt64(&totalBytesDeleted, 0)
 	scanStartTime = time.Now()
 	lastUpdateTime = scanStartTime
 	lastFilesScanned = 0
 	lastFilesWritten = 0
 
 	log.Printf("Starting scan of folder: %s", folderPath)
+	limiter := newRateLimiter(opts.HashRateLimit)
+
+	// Every row written or confirmed by this scan gets the writer's seenAt
+	// as last_seen.
+	writer := newBatchWriter(store, tableName, opts, limiter)
+	seenAt := writer.seenAt
+	scanStateLock.Lock()
+	resumed := len(scanState.FilesScanned) > 0
+	scanStateLock.Unlock()
+	var walkErrors int64
+	totals := newDirTotals(folderPath)
+
+	workerOpts := opts.forWorkers()
 
 	// Start workers
 	for i := 0; i < numWorkers; i++ {
@@ -63,41 +130,41 @@ func scanFolder(ctx context.Context, db *sql.DB, tableName, folderPath string) e
 				case <-ctx.Done():
 					return
 				default:
-					fileInfo, err := processFile(filePath)
+					fileInfo, err := processFile(ctx, filePath, workerOpts, limiter)
+					if errors.Is(err, errFiltered) {
+						continue
+					}
 					if err != nil {
 						log.Printf("Error processing file %s: %v", filePath, err)
 						continue // Skip this file and continue with others
 					}
-					resultChan <- fileInfo
-					atomic.AddInt64(&totalFilesScanned, 1)
+					select {
+					case <-ctx.Done():
+						return
+					case resultChan <- fileInfo:
+						atomic.AddInt64(&totalFilesScanned, 1)
+					}
 				}
 			}
 		}()
 	}
 
-	// Start batch insert worker
+	// Start batch insert worker. It owns writeDone so the scan only counts as
+	// finished once the final batch has been written.
 	go func() {
-		defer close(resultChan)
-		batch := make([]FileInfo, 0, batchSize)
+		defer close(writeDone)
 		for fileInfo := range resultChan {
-			batch = append(batch, fileInfo)
-			if len(batch) >= batchSize {
-				if err := batchInsert(db, tableName, batch); err != nil {
-					log.Printf("Error batch inserting: %v", err)
-					errChan <- fmt.Errorf("error batch inserting: %v", err)
-					return
-				}
-				atomic.AddInt64(&totalFilesWritten, int64(len(batch)))
-				batch = batch[:0]
-			}
-		}
-		if len(batch) > 0 {
-			if err := batchInsert(db, tableName, batch); err != nil {
-				log.Printf("Error batch inserting final batch: %v", err)
-				errChan <- fmt.Errorf("error batch inserting final batch: %v", err)
+			totals.addFile(fileInfo)
+			if err := writer.add(ctx, fileInfo); err != nil {
+				log.Printf("Error batch inserting: %v", err)
+				errChan <- fmt.Errorf("error batch inserting: %v", err)
 				return
 			}
-			atomic.AddInt64(&totalFilesWritten, int64(len(batch)))
+		}
+		if err := writer.flush(ctx); err != nil {
+			log.Printf("Error batch inserting final batch: %v", err)
+			errChan <- fmt.Errorf("error batch inserting final batch: %v", err)
+			return
 		}
 	}()
 
@@ -107,9 +174,17 @@ func scanFolder(ctx context.Context, db *sql.DB, tableName, folderPath string) e
 		err := filepath.WalkDir(folderPath, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
 				log.Printf("Error walking directory at %s: %v", path, err)
+				atomic.AddInt64(&walkErrors, 1)
 				return nil // Continue walking despite the error
 			}
 			if d.IsDir() {
+				if opts.Filters.pruneDir(folderPath, path) {
+					return filepath.SkipDir
+				}
+				totals.addDir(path, d)
+				return nil
+			}
+			if !opts.Filters.matchName(folderPath, path) {
 				return nil
 			}
 			scanStateLock.Lock()
@@ -127,7 +202,7 @@ func scanFolder(ctx context.Context, db *sql.DB, tableName, folderPath string) e
 				return nil
 			}
 		})
-		if err != nil {
+		if err != nil && ctx.Err() == nil {
 			log.Printf("Error walking directory: %v", err)
 			errChan <- fmt.Errorf("error walking directory: %v", err)
 		}
@@ -145,33 +220,259 @@ func scanFolder(ctx context.Context, db *sql.DB, tableName, folderPath string) e
 	case err := <-errChan:
 		log.Printf("Scan completed with error: %v", err)
 		return err
-	case <-resultChan:
-		log.Println("Scan completed successfully")
+	case <-writeDone:
+	}
+
+	// The writer also stops early after sending an error, so check again
+	// before reporting success.
+	select {
+	case err := <-errChan:
+		log.Printf("Scan completed with error: %v", err)
+		return err
+	default:
+	}
+	if ctx.Err() != nil {
+		log.Println("Scan cancelled")
+		return ctx.Err()
+	}
+
+	// Files skipped by a resumed scan are missing from the totals, so their
+	// directories keep the rows of the scan that found them.
+	if resumed {
+		log.Println("Not updating directory totals: the scan was resumed")
+	} else if err := writeDirectories(store, tableName, totals.rows(), writer.size, seenAt); err != nil {
+		log.Printf("Error writing directories: %v", err)
+		return err
+	}
+
+	if tracker, ok := store.(ChangeTracker); ok {
+		// Files skipped by a resumed scan, left out by a filter or hidden by
+		// a walk error would look deleted, so only a clean, uninterrupted,
+		// unfiltered walk marks them.
+		switch {
+		case resumed:
+			log.Println("Not marking deleted files: the scan was resumed")
+		case opts.Filters.active():
+			log.Println("Not marking deleted files: filter rules are set")
+		case atomic.LoadInt64(&walkErrors) > 0:
+			log.Printf("Not marking deleted files: %d directories could not be read", atomic.LoadInt64(&walkErrors))
+		default:
+			summary, err := tracker.MarkUnseen(tableName, folderPath, seenAt, opts.PurgeDeleted)
+			if err != nil {
+				log.Printf("Error marking deleted files: %v", err)
+				return fmt.Errorf("error marking deleted files: %v", err)
+			}
+			atomic.StoreInt64(&totalFilesDeleted, summary.Files)
+			atomic.StoreInt64(&totalBytesDeleted, summary.Bytes)
+			action := "Marked"
+			if opts.PurgeDeleted {
+				action = "Purged"
+			}
+			log.Printf("%s %d deleted files (%s) in '%s'", action, summary.Files, formatBytes(summary.Bytes), tableName)
+		}
+	}
+
+	if err := store.Finalize(tableName); err != nil {
+		log.Printf("Error finalizing scan: %v", err)
+		return fmt.Errorf("error finalizing scan: %v", err)
+	}
+
+	if opts.Incremental {
+		newFiles, changedFiles, unchangedFiles := GetChangeStats()
+		log.Printf("Incremental scan: %d new, %d changed, %d unchanged files", newFiles, changedFiles, unchangedFiles)
+	}
+	log.Println("Scan completed successfully")
+	return nil
+}
+
+// forWorkers returns the options processFile should use. Incremental scans
+// hash and extract content in the batch writer, once unchanged files have
+// been filtered out.
+func (o ScanOptions) forWorkers() ScanOptions {
+	if o.Incremental {
+		o.HashAlgorithm = hashNone
+		o.ExtractContent = false
+		o.DetectMIME = false
+	}
+	return o
+}
+
+// batchWriter collects scanned files and writes them to a catalog in batches
+// of the backend's preferred size. It is used by one goroutine at a time.
+type batchWriter struct {
+	store     Storage
+	tableName string
+	opts      ScanOptions
+	limiter   *rateLimiter
+	size      int
+	batch     []FileInfo
+	// seenAt is written as last_seen. A scan keeps its start time; watch
+	// mode moves it forward for every round of events. UTC at millisecond
+	// precision is stored exactly by every backend, so the value compares
+	// equal when read back.
+	seenAt time.Time
+}
+
+func newBatchWriter(store Storage, tableName string, opts ScanOptions, limiter *rateLimiter) *batchWriter {
+	size := batchSize
+	if sizer, ok := store.(batchSizer); ok {
+		size = sizer.BatchSize()
+	}
+	return &batchWriter{
+		store:     store,
+		tableName: tableName,
+		opts:      opts,
+		limiter:   limiter,
+		size:      size,
+		batch:     make([]FileInfo, 0, size),
+		seenAt:    time.Now().UTC().Truncate(time.Millisecond),
+	}
+}
+
+// add queues a file and writes the batch once it is full.
+func (w *batchWriter) add(ctx context.Context, file FileInfo) error {
+	w.batch = append(w.batch, file)
+	if len(w.batch) >= w.size {
+		return w.flush(ctx)
+	}
+	return nil
+}
+
+// flush writes whatever is queued.
+func (w *batchWriter) flush(ctx context.Context) error {
+	if len(w.batch) == 0 {
+		return nil
+	}
+	err := writeBatch(ctx, w.store, w.tableName, w.batch, w.opts, w.limiter, w.seenAt)
+	w.batch = w.batch[:0]
+	return err
+}
+
+// writeBatch stores one batch of scanned files. Incremental scans first drop
+// the files the catalog already holds unchanged, only updating their
+// last_seen, then hash and extract content for what is left.
+func writeBatch(ctx context.Context, store Storage, tableName string, batch []FileInfo, opts ScanOptions, limiter *rateLimiter, seenAt time.Time) error {
+	for i := range batch {
+		batch[i].LastSeen = seenAt
+	}
+
+	if opts.Incremental {
+		pathHashes := make([]string, len(batch))
+		for i, file := range batch {
+			pathHashes[i] = file.PathHash
+		}
+		states, err := store.(ChangeTracker).LookupFiles(tableName, pathHashes)
+		if err != nil {
+			return err
+		}
+
+		changed := make([]FileInfo, 0, len(batch))
+		var unchanged []string
+		var toHash []int
+		for _, file := range batch {
+			state, ok := states[file.PathHash]
+			switch {
+			case !ok:
+				atomic.AddInt64(&totalFilesNew, 1)
+			case state.FileSize != file.FileSize || !sameModTime(state.ModTime, file.ModTime) || state.Outdated:
+				atomic.AddInt64(&totalFilesChanged, 1)
+			default:
+				atomic.AddInt64(&totalFilesUnchanged, 1)
+				unchanged = append(unchanged, file.PathHash)
+				continue
+			}
+			if opts.HashAlgorithm != hashNone {
+				toHash = append(toHash, len(changed))
+			}
+			changed = append(changed, file)
+		}
+		if len(toHash) > 0 {
+			if err := hashCandidates(ctx, changed, toHash, opts.HashAlgorithm, limiter); err != nil {
+				return err
+			}
+		}
+		if (opts.ExtractContent || opts.DetectMIME) && len(changed) > 0 {
+			indexes := make([]int, len(changed))
+			for i := range indexes {
+				indexes[i] = i
+			}
+			if err := forEachIndex(ctx, indexes, func(i int) { inspectContent(&changed[i], opts) }); err != nil {
+				return err
+			}
+		}
+		if err := store.(ChangeTracker).TouchFiles(tableName, unchanged, seenAt); err != nil {
+			return err
+		}
+		batch = changed
 	}
 
+	if err := store.UpsertBatch(tableName, batch); err != nil {
+		return err
+	}
+	atomic.AddInt64(&totalFilesWritten, int64(len(batch)))
 	return nil
 }
 
-func processFile(filePath string) (FileInfo, error) {
-	info, err := os.Stat(filePath)
+func processFile(ctx context.Context, filePath string, opts ScanOptions, limiter *rateLimiter) (FileInfo, error) {
+	link, err := os.Lstat(filePath)
 	if err != nil {
 		return FileInfo{}, fmt.Errorf("error getting file info: %v", err)
 	}
+	// Symbolic links are recorded with the size and times of their target.
+	// A dangling link is recorded as itself.
+	info := link
+	if link.Mode()&os.ModeSymlink != 0 {
+		if target, err := os.Stat(filePath); err == nil {
+			info = target
+		}
+	}
 
-	// Create a unique hash based on the file path
-	hasher := sha256.New()
-	hasher.Write([]byte(filePath))
-	pathHash := hex.EncodeToString(hasher.Sum(nil))
+	if !opts.Filters.matchInfo(info.Size(), info.ModTime()) {
+		return FileInfo{}, errFiltered
+	}
 
-	return FileInfo{
+	// A file that cannot be read is still recorded, without a hash, so it
+	// is not mistaken for a deleted one.
+	var contentHash string
+	if opts.HashAlgorithm != hashNone {
+		contentHash, err = hashFileContent(ctx, filePath, opts.HashAlgorithm, limiter)
+		if err != nil {
+			if ctx.Err() != nil {
+				return FileInfo{}, err
+			}
+			log.Printf("Error hashing %s: %v", filePath, err)
+		}
+	}
+
+	file := FileInfo{
 		FileName:      info.Name(),
 		FilePath:      filePath,
-		PathHash:      pathHash,
+		PathHash:      pathHash(filePath),
+		ParentHash:    parentHash(filePath),
+		Depth:         pathDepth(filePath),
 		FileSize:      info.Size(),
 		ModTime:       info.ModTime(),
-		OtherMetadata: "", // You may want to implement other metadata collection
+		OtherMetadata: encodeMetadata(collectMetadata(filePath, info, link)),
 		Extension:     filepath.Ext(filePath),
-	}, nil
+		ContentHash:   contentHash,
+	}
+	if info.Mode().IsRegular() {
+		inspectContent(&file, opts)
+	}
+	return file, nil
+}
+
+// inspectContent reads what the ExtractContent and DetectMIME options ask
+// for from the file itself. Failures are logged and the file is kept.
+func inspectContent(file *FileInfo, opts ScanOptions) {
+	if opts.DetectMIME {
+		if err := detectMIME(file); err != nil {
+			log.Printf("Error detecting type of %s: %v", file.FilePath, err)
+		}
+	}
+	if opts.ExtractContent {
+		addContentMetadata(file)
+	}
 }
 
 func GetProgressStats() (int64, int64, float64, float64) {
@@ -190,3 +491,17 @@ func GetProgressStats() (int64, int64, float64, float64) {
 
 	return filesScanned, filesWritten, scanSpeed, writeSpeed
 }
+
+// GetChangeStats returns the new, changed and unchanged file counts of the
+// current incremental scan.
+func GetChangeStats() (int64, int64, int64) {
+	return atomic.LoadInt64(&totalFilesNew),
+		atomic.LoadInt64(&totalFilesChanged),
+		atomic.LoadInt64(&totalFilesUnchanged)
+}
+
+// GetDeletionStats returns the number and total size of the files the last
+// completed scan marked as deleted or purged.
+func GetDeletionStats() (int64, int64) {
+	return atomic.LoadInt64(&totalFilesDeleted), atomic.LoadInt64(&totalBytesDeleted)
+}
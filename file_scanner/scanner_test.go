@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// scanTestFolder runs a fresh, not resumed scan of root into "files".
+func scanTestFolder(t *testing.T, store Storage, root string, opts ScanOptions) {
+	t.Helper()
+	scanStateLock.Lock()
+	scanState.FilesScanned = make(map[string]bool)
+	scanStateLock.Unlock()
+	if err := scanFolder(context.Background(), store, "files", root, opts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// catalogState returns whether each row of "files" is marked deleted, by
+// path.
+func catalogState(t *testing.T, store Storage) map[string]bool {
+	t.Helper()
+	rows, err := store.(*sqliteStorage).db.Query(`SELECT file_path, deleted_at IS NOT NULL FROM files`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	state := make(map[string]bool)
+	for rows.Next() {
+		var path string
+		var deleted bool
+		if err := rows.Scan(&path, &deleted); err != nil {
+			t.Fatal(err)
+		}
+		state[path] = deleted
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+// newDeletionFixture scans a folder, and a sibling whose name it is a
+// prefix of, then removes a file and a directory from the first one.
+func newDeletionFixture(t *testing.T) (store Storage, root, sibling string) {
+	t.Helper()
+	dir := t.TempDir()
+	root = filepath.Join(dir, "root")
+	sibling = filepath.Join(dir, "root2")
+	for _, path := range []string{
+		filepath.Join(root, "keep.txt"),
+		filepath.Join(root, "gone.txt"),
+		filepath.Join(root, "old", "inner.txt"),
+		filepath.Join(sibling, "other.txt"),
+	} {
+		writeTestFile(t, path, 4)
+	}
+	store = openTestCatalog(t)
+	scanTestFolder(t, store, root, ScanOptions{})
+	scanTestFolder(t, store, sibling, ScanOptions{})
+
+	if err := os.Remove(filepath.Join(root, "gone.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(root, "old")); err != nil {
+		t.Fatal(err)
+	}
+	return store, root, sibling
+}
+
+func TestScanMarksRemovedFilesDeleted(t *testing.T) {
+	store, root, sibling := newDeletionFixture(t)
+	scanTestFolder(t, store, root, ScanOptions{})
+
+	want := map[string]bool{
+		root:                                    false,
+		filepath.Join(root, "keep.txt"):         false,
+		filepath.Join(root, "gone.txt"):         true,
+		filepath.Join(root, "old"):              true,
+		filepath.Join(root, "old", "inner.txt"): true,
+		sibling:                                 false,
+		filepath.Join(sibling, "other.txt"):     false,
+	}
+	state := catalogState(t, store)
+	for path, deleted := range want {
+		if got, ok := state[path]; !ok || got != deleted {
+			t.Errorf("%s: in catalog %t, deleted %t; want deleted %t", path, ok, got, deleted)
+		}
+	}
+}
+
+func TestScanKeepsRowsWhenDeletionsAreUnknown(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   ScanOptions
+		resume bool
+	}{
+		{"filtered", ScanOptions{Filters: FilterRules{Exclude: []string{"*.tmp"}}}, false},
+		{"resumed", ScanOptions{}, true},
+		{"resumed with purge", ScanOptions{PurgeDeleted: true}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, root, _ := newDeletionFixture(t)
+			scanStateLock.Lock()
+			scanState.FilesScanned = make(map[string]bool)
+			if test.resume {
+				scanState.FilesScanned[filepath.Join(root, "keep.txt")] = true
+			}
+			scanStateLock.Unlock()
+			if err := scanFolder(context.Background(), store, "files", root, test.opts); err != nil {
+				t.Fatal(err)
+			}
+
+			state := catalogState(t, store)
+			if len(state) != 7 {
+				t.Errorf("catalog has %d rows, want all 7", len(state))
+			}
+			for path, deleted := range state {
+				if deleted {
+					t.Errorf("%s was marked deleted", path)
+				}
+			}
+		})
+	}
+}
+
+func TestScanPurgeDeleted(t *testing.T) {
+	store, root, sibling := newDeletionFixture(t)
+	scanTestFolder(t, store, root, ScanOptions{PurgeDeleted: true})
+
+	want := []string{root, filepath.Join(root, "keep.txt"), sibling, filepath.Join(sibling, "other.txt")}
+	state := catalogState(t, store)
+	if len(state) != len(want) {
+		t.Errorf("catalog has %d rows, want %d: %v", len(state), len(want), state)
+	}
+	for _, path := range want {
+		if deleted, ok := state[path]; !ok || deleted {
+			t.Errorf("%s: in catalog %t, deleted %t; want kept", path, ok, deleted)
+		}
+	}
+}
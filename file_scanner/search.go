@@ -0,0 +1,109 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FileQuery selects catalogued files to browse, one page at a time. Empty
+// fields do not filter.
+type FileQuery struct {
+	// NameContains matches a substring of the file name, ignoring case.
+	NameContains string
+	// Extension matches the extension, ignoring case and the leading dot.
+	Extension string
+	// MinSize and MaxSize bound the file size in bytes. Zero means no bound.
+	MinSize int64
+	MaxSize int64
+	// ModifiedAfter and ModifiedBefore bound the modification time.
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	// Offset and Limit select the page, in path order.
+	Offset int
+	Limit  int
+}
+
+// defaultPageSize is the page size used when FileQuery.Limit is not set.
+const defaultPageSize = 100
+
+func (q FileQuery) validate() error {
+	if q.MinSize < 0 || q.MaxSize < 0 {
+		return fmt.Errorf("file size limits cannot be negative")
+	}
+	if q.MaxSize > 0 && q.MinSize > q.MaxSize {
+		return fmt.Errorf("minimum file size is larger than the maximum")
+	}
+	if !q.ModifiedAfter.IsZero() && !q.ModifiedBefore.IsZero() && !q.ModifiedAfter.Before(q.ModifiedBefore) {
+		return fmt.Errorf("modified-after date is not before the modified-before date")
+	}
+	if q.Offset < 0 || q.Limit < 0 {
+		return fmt.Errorf("page offset and size cannot be negative")
+	}
+	return nil
+}
+
+// Paging clauses for searchFiles. SQL Server and PostgreSQL accept the
+// standard OFFSET ... FETCH; SQLite only knows LIMIT.
+const (
+	offsetFetch = "OFFSET %[1]s ROWS FETCH NEXT %[2]s ROWS ONLY"
+	limitOffset = "LIMIT %[2]s OFFSET %[1]s"
+)
+
+// searchFiles is SearchFiles for the SQL backends. paging is the backend's
+// paging clause, formatted with the offset and limit placeholders.
+func searchFiles(db *sql.DB, name string, q FileQuery, paging string, placeholder func(i int) string) ([]FileInfo, int64, error) {
+	if err := q.validate(); err != nil {
+		return nil, 0, err
+	}
+	conditions := []string{isFile, "deleted_at IS NULL"}
+	var args []interface{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, placeholder(len(args))))
+	}
+	if q.NameContains != "" {
+		add(`LOWER(file_name) LIKE %s ESCAPE '\'`, "%"+escapeLike(strings.ToLower(q.NameContains))+"%")
+	}
+	if extension := strings.TrimPrefix(strings.TrimSpace(q.Extension), "."); extension != "" {
+		add("LOWER(extension) = %s", "."+strings.ToLower(extension))
+	}
+	if q.MinSize > 0 {
+		add("file_size >= %s", q.MinSize)
+	}
+	if q.MaxSize > 0 {
+		add("file_size <= %s", q.MaxSize)
+	}
+	if !q.ModifiedAfter.IsZero() {
+		add("mod_time >= %s", q.ModifiedAfter)
+	}
+	if !q.ModifiedBefore.IsZero() {
+		add("mod_time < %s", q.ModifiedBefore)
+	}
+	where := strings.Join(conditions, " AND ")
+
+	var total int64
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", name, where)
+	if err := db.QueryRow(countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting files: %v", err)
+	}
+
+	limit := q.Limit
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	args = append(args, q.Offset, limit)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY file_path %s", listColumns, name, where,
+		fmt.Sprintf(paging, placeholder(len(args)-1), placeholder(len(args))))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error searching files: %v", err)
+	}
+	defer rows.Close()
+	files, err := scanListedFiles(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return files, total, nil
+}
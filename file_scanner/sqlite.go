@@ -0,0 +1,308 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteStorage keeps catalogs as tables in a local SQLite file, for scans on
+// machines that cannot reach a database server. ConnectionConfig.Database is
+// the path of the .db file.
+type sqliteStorage struct {
+	db *sql.DB
+}
+
+func openSQLiteStorage(cfg ConnectionConfig) (Storage, error) {
+	if cfg.Database == "" {
+		return nil, fmt.Errorf("no SQLite database file given")
+	}
+
+	db, err := sql.Open("sqlite3", sqliteDSN(cfg.Database))
+	if err != nil {
+		return nil, fmt.Errorf("error opening SQLite database: %v", err)
+	}
+	// SQLite allows a single writer; one connection avoids busy errors
+	// between the batch writer and other queries.
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error opening SQLite database: %v", err)
+	}
+
+	log.Printf("Opened SQLite database %s", cfg.Database)
+	return &sqliteStorage{db: db}, nil
+}
+
+// sqliteDSN returns the file: URI that opens the database at path. The path
+// is escaped, so names holding ? or # are not cut short at the query.
+func sqliteDSN(path string) string {
+	escaped := (&url.URL{Path: filepath.ToSlash(path)}).EscapedPath()
+	if strings.HasPrefix(escaped, "//") {
+		// A UNC path; SQLite only accepts an empty URI authority.
+		escaped = "//" + escaped
+	}
+	query := url.Values{}
+	query.Set("_journal_mode", "WAL")
+	query.Set("_busy_timeout", "5000")
+	dsn := url.URL{
+		Scheme:   "file",
+		Opaque:   escaped,
+		RawQuery: query.Encode(),
+	}
+	return dsn.String()
+}
+
+// sqliteAddedColumns are added to tables created before they existed.
+var sqliteAddedColumns = []addedColumn{
+	{"content_hash", "VARCHAR(80) NULL"},
+	{"last_seen", "DATETIME NULL"},
+	{"deleted_at", "DATETIME NULL"},
+	{"mime_type", "VARCHAR(100) NULL"},
+	{"mime_mismatch", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"parent_path_hash", "VARCHAR(64) NULL"},
+	{"is_dir", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"file_count", "INTEGER NOT NULL DEFAULT 0"},
+	{"depth", "INTEGER NULL"},
+}
+
+// sqliteTable validates a catalog name and quotes it for SQLite, which has
+// no schemas to qualify it with.
+func sqliteTable(name string) (string, error) {
+	table, err := parseCatalogTable(name, maxIdentifierLength)
+	if err != nil {
+		return "", err
+	}
+	if table.schema != "" {
+		return "", fmt.Errorf("invalid table name %q: SQLite tables have no schema", name)
+	}
+	return table.quoted(doubleQuote), nil
+}
+
+func (s *sqliteStorage) CreateCatalog(name string) error {
+	table, err := sqliteTable(name)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		file_name TEXT NOT NULL,
+		file_path TEXT NULL,
+		path_hash VARCHAR(64) NOT NULL UNIQUE,
+		file_size INTEGER NOT NULL,
+		mod_time DATETIME NOT NULL,
+		other_metadata TEXT NULL,
+		extension VARCHAR(50) NULL,
+		content_hash VARCHAR(80) NULL,
+		last_seen DATETIME NULL,
+		deleted_at DATETIME NULL,
+		mime_type VARCHAR(100) NULL,
+		mime_mismatch BOOLEAN NOT NULL DEFAULT FALSE,
+		parent_path_hash VARCHAR(64) NULL,
+		is_dir BOOLEAN NOT NULL DEFAULT FALSE,
+		file_count INTEGER NOT NULL DEFAULT 0,
+		depth INTEGER NULL
+	)`, table)
+
+	if _, err := s.db.Exec(query); err != nil {
+		return fmt.Errorf("error creating table: %v", err)
+	}
+
+	for _, column := range sqliteAddedColumns {
+		var count int
+		err := s.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", name, column.name).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("error checking column %s: %v", column.name, err)
+		}
+		if count > 0 {
+			continue
+		}
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column.name, column.definition)
+		if _, err := s.db.Exec(query); err != nil {
+			return fmt.Errorf("error adding column %s: %v", column.name, err)
+		}
+	}
+
+	// The index serves ListChildren and the joins of SubtreeTotals.
+	query = fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (parent_path_hash)", doubleQuote(name+parentIndexSuffix), table)
+	if _, err := s.db.Exec(query); err != nil {
+		return fmt.Errorf("error creating parent index: %v", err)
+	}
+
+	log.Printf("Table '%s' created or already exists", name)
+	return nil
+}
+
+func (s *sqliteStorage) ListCatalogs() ([]string, error) {
+	rows, err := s.db.Query(`SELECT name FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tables: %v", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	var tableName string
+	for rows.Next() {
+		if err := rows.Scan(&tableName); err != nil {
+			return nil, fmt.Errorf("error scanning table name: %v", err)
+		}
+		tables = append(tables, tableName)
+	}
+	return tables, rows.Err()
+}
+
+// sqlitePlaceholder numbers parameters so a statement can use them in any
+// order.
+func sqlitePlaceholder(i int) string {
+	return fmt.Sprintf("?%d", i)
+}
+
+func (s *sqliteStorage) LookupFiles(name string, pathHashes []string) (map[string]FileState, error) {
+	table, err := sqliteTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return queryFileStates(s.db, table, pathHashes, sqlitePlaceholder)
+}
+
+func (s *sqliteStorage) TouchFiles(name string, pathHashes []string, seenAt time.Time) error {
+	table, err := sqliteTable(name)
+	if err != nil {
+		return err
+	}
+	return touchFileRows(s.db, table, pathHashes, seenAt, sqlitePlaceholder)
+}
+
+func (s *sqliteStorage) MarkUnseen(name, rootPath string, seenAt time.Time, purge bool) (DeletionSummary, error) {
+	table, err := sqliteTable(name)
+	if err != nil {
+		return DeletionSummary{}, err
+	}
+	return markUnseenRows(s.db, table, rootPath, seenAt, purge, sqlitePlaceholder)
+}
+
+func (s *sqliteStorage) MarkDeleted(name string, paths []string, purge bool) (DeletionSummary, error) {
+	table, err := sqliteTable(name)
+	if err != nil {
+		return DeletionSummary{}, err
+	}
+	return markDeletedRows(s.db, table, paths, purge, sqlitePlaceholder)
+}
+
+func (s *sqliteStorage) ListChildren(name, path string) ([]FileInfo, error) {
+	table, err := sqliteTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return listChildren(s.db, table, path, sqlitePlaceholder)
+}
+
+func (s *sqliteStorage) SubtreeTotals(name, path string) (int64, int64, error) {
+	table, err := sqliteTable(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	return subtreeTotals(s.db, table, path, "WITH RECURSIVE", "", sqlitePlaceholder)
+}
+
+// sqliteOwner reads the owner name from other_metadata, falling back to the
+// numeric uid. Rows written before metadata was JSON hold an empty string.
+const sqliteOwner = `CASE WHEN json_valid(other_metadata)
+	THEN COALESCE(json_extract(other_metadata, '$.owner'), CAST(json_extract(other_metadata, '$.uid') AS TEXT)) END`
+
+func (s *sqliteStorage) UsageBreakdown(name, path, by string) ([]UsageGroup, error) {
+	table, err := sqliteTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return usageBreakdown(s.db, table, path, by, sqliteOwner, sqlitePlaceholder)
+}
+
+func (s *sqliteStorage) SearchFiles(name string, query FileQuery) ([]FileInfo, int64, error) {
+	table, err := sqliteTable(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	return searchFiles(s.db, table, query, limitOffset, sqlitePlaceholder)
+}
+
+func (s *sqliteStorage) StreamFiles(name, root string, fn func(FileInfo) error) error {
+	table, err := sqliteTable(name)
+	if err != nil {
+		return err
+	}
+	return streamFiles(s.db, table, root, fn, sqlitePlaceholder)
+}
+
+func (s *sqliteStorage) SizeCollisions(name string) ([]FileInfo, error) {
+	table, err := sqliteTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return querySizeCollisions(s.db, table)
+}
+
+// UpsertBatch writes the batch in one transaction. SQLite is fast with
+// prepared single-row statements inside a transaction, so there is no need
+// for the multi-row VALUES list the SQL Server backend builds.
+func (s *sqliteStorage) UpsertBatch(name string, files []FileInfo) error {
+	if len(files) == 0 {
+		return nil
+	}
+	table, err := sqliteTable(name)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(fileColumns)), ", ")
+	stmt, err := tx.Prepare(fmt.Sprintf(`
+	INSERT INTO %s (%s)
+	VALUES (%s)
+	ON CONFLICT (path_hash) DO UPDATE SET
+		%s`, table, strings.Join(fileColumns, ", "), placeholders, upsertAssignments("excluded")))
+	if err != nil {
+		return fmt.Errorf("error preparing upsert: %v", err)
+	}
+	defer stmt.Close()
+
+	for _, file := range files {
+		if _, err := stmt.Exec(fileValues(file)...); err != nil {
+			return fmt.Errorf("error upserting %s: %v", file.FilePath, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing batch: %v", err)
+	}
+
+	log.Printf("Successfully upserted %d files into the SQLite database", len(files))
+	return nil
+}
+
+// Finalize folds the write-ahead log back into the main file so the .db file
+// can be copied off the machine on its own.
+func (s *sqliteStorage) Finalize(name string) error {
+	if _, err := s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return fmt.Errorf("error checkpointing SQLite database: %v", err)
+	}
+	return nil
+}
+
+func (s *sqliteStorage) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type FileInfo struct {
+	FileName      string
+	FilePath      string
+	PathHash      string
+	FileSize      int64
+	ModTime       time.Time
+	OtherMetadata string
+	Extension     string
+	ContentHash   string    // "algorithm:hex" when content hashing is enabled
+	LastSeen      time.Time // start of the scan that last found the file, in UTC
+	MIMEType      string    // sniffed from the content when MIME detection is enabled
+	MIMEMismatch  bool      // MIMEType contradicts the extension
+	ParentHash    string    // PathHash of the containing directory
+	IsDir         bool      // directory rows total the files below them:
+	FileCount     int64     // FileSize is their size and FileCount their number
+	Depth         int       // number of path elements below the volume root
+}
+
+// Storage is a destination for scan results. A store holds any number of
+// catalogs, each a set of FileInfo rows keyed by PathHash. scanFolder only
+// talks to this interface, so new backends need no changes to the scanner.
+// The SQL backends check catalog names with parseCatalogTable and pass them
+// quoted to the query helpers below, which put them into statements as is.
+type Storage interface {
+	// CreateCatalog creates the named catalog if it does not exist yet.
+	CreateCatalog(name string) error
+	// ListCatalogs returns the names of the catalogs in the store.
+	ListCatalogs() ([]string, error)
+	// UpsertBatch inserts files that are new to the catalog and updates the
+	// rows of files already in it, matching on PathHash.
+	UpsertBatch(name string, files []FileInfo) error
+	// Finalize is called once after the last batch of a successful scan.
+	Finalize(name string) error
+	Close() error
+}
+
+// CatalogReader is implemented by backends that can read a catalog back,
+// which the reports built on top of a scan need.
+type CatalogReader interface {
+	// SizeCollisions returns the non-empty files whose size is shared by at
+	// least one other file in the catalog, ordered by size.
+	SizeCollisions(name string) ([]FileInfo, error)
+	// ListChildren returns the files and directories directly inside the
+	// directory at path, directories first, then by name.
+	ListChildren(name, path string) ([]FileInfo, error)
+	// SubtreeTotals returns the number and total size of the files in the
+	// catalog below the directory at path.
+	SubtreeTotals(name, path string) (files, bytes int64, err error)
+	// UsageBreakdown groups the files below the directory at path by
+	// extension, age or owner (see the breakdown constants) and returns the
+	// number and size of the files in each group.
+	UsageBreakdown(name, path, by string) ([]UsageGroup, error)
+	// SearchFiles returns one page of the files matching query, in path
+	// order, and the number of matching files on all pages.
+	SearchFiles(name string, query FileQuery) ([]FileInfo, int64, error)
+	// StreamFiles calls fn for every row in the catalog that is not marked
+	// deleted, in path order, without holding them all in memory. A
+	// non-empty root limits the rows to root and what is below it. An error
+	// from fn stops the stream and is returned.
+	StreamFiles(name, root string, fn func(FileInfo) error) error
+}
+
+// FileState is what an incremental scan compares against: the size and
+// modification time a catalog holds for a file.
+type FileState struct {
+	FileSize int64
+	ModTime  time.Time
+	// Outdated rows were written before the hierarchy columns existed and
+	// are rewritten even when the file is unchanged.
+	Outdated bool
+}
+
+// ChangeTracker is implemented by backends that can report what a catalog
+// already holds, which incremental scans need.
+type ChangeTracker interface {
+	// LookupFiles returns the stored state of the given path hashes. Hashes
+	// not in the catalog are absent from the map.
+	LookupFiles(name string, pathHashes []string) (map[string]FileState, error)
+	// TouchFiles records that unchanged files were seen by the scan started
+	// at seenAt without rewriting their rows.
+	TouchFiles(name string, pathHashes []string, seenAt time.Time) error
+	// MarkUnseen flags the files under rootPath that the scan started at
+	// seenAt did not find, or deletes their rows when purge is set.
+	MarkUnseen(name, rootPath string, seenAt time.Time, purge bool) (DeletionSummary, error)
+	// MarkDeleted flags the given files, and everything below any of them
+	// that is a directory, as deleted, or deletes their rows when purge is
+	// set.
+	MarkDeleted(name string, paths []string, purge bool) (DeletionSummary, error)
+}
+
+// DeletionSummary describes the files a completed scan no longer found.
+// Directory rows are marked along with their files but not counted.
+type DeletionSummary struct {
+	Files int64
+	Bytes int64
+}
+
+// batchSizer is implemented by backends whose best batch size differs from
+// the default batchSize.
+type batchSizer interface {
+	BatchSize() int
+}
+
+// storageBackends maps ConnectionConfig.Backend to the function that opens it.
+var storageBackends = map[string]func(ConnectionConfig) (Storage, error){
+	"mssql":    openMSSQLStorage,
+	"sqlite":   openSQLiteStorage,
+	"postgres": openPostgresStorage,
+	"files":    openFileSink,
+}
+
+const defaultBackend = "mssql"
+
+func openStorage(cfg ConnectionConfig) (Storage, error) {
+	backend := cfg.Backend
+	if backend == "" {
+		backend = defaultBackend
+	}
+	open, ok := storageBackends[backend]
+	if !ok {
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+	return open(cfg)
+}
+
+// fileColumns lists the catalog columns written by UpsertBatch, in the order
+// of the values returned by fileValues. Every backend upserts on path_hash.
+// Catalogs also have a deleted_at column, which only MarkUnseen sets.
+var fileColumns = []string{
+	"file_name", "file_path", "path_hash", "file_size", "mod_time",
+	"other_metadata", "extension", "content_hash", "last_seen",
+	"mime_type", "mime_mismatch", "parent_path_hash", "is_dir", "file_count",
+	"depth",
+}
+
+func fileValues(file FileInfo) []interface{} {
+	return []interface{}{
+		file.FileName, file.FilePath, file.PathHash, file.FileSize, file.ModTime,
+		file.OtherMetadata, file.Extension, nullString(file.ContentHash), nullTime(file.LastSeen),
+		nullString(file.MIMEType), file.MIMEMismatch, nullString(file.ParentHash), file.IsDir,
+		file.FileCount, file.Depth,
+	}
+}
+
+// upsertAssignments returns "column = source.column" for every column except
+// the path_hash key, for the update half of an upsert statement. A file that
+// is written again exists, so its deleted_at is cleared as well.
+func upsertAssignments(source string) string {
+	assignments := make([]string, 0, len(fileColumns)+1)
+	for _, column := range fileColumns {
+		if column != "path_hash" {
+			assignments = append(assignments, fmt.Sprintf("%s = %s.%s", column, source, column))
+		}
+	}
+	assignments = append(assignments, "deleted_at = NULL")
+	return strings.Join(assignments, ",\n\t\t")
+}
+
+// addedColumn is a column introduced after a backend's original schema.
+// CreateCatalog adds any that are missing so older catalogs keep working.
+type addedColumn struct {
+	name       string
+	definition string
+}
+
+// isFile selects file rows rather than directory rows. SQL Server has no
+// boolean literals, but the string '0' converts to its BIT, to PostgreSQL's
+// BOOLEAN and to SQLite's integer alike.
+const isFile = "is_dir = '0'"
+
+// isDirectory selects directory rows.
+const isDirectory = "is_dir = '1'"
+
+// sizeCollisionsQuery is plain enough SQL to be shared by every backend.
+const sizeCollisionsQuery = `
+	SELECT file_name, file_path, path_hash, file_size, mod_time, COALESCE(content_hash, '')
+	FROM %[1]s
+	WHERE deleted_at IS NULL AND ` + isFile + ` AND file_size IN (
+		SELECT file_size FROM %[1]s
+		WHERE file_size > 0 AND deleted_at IS NULL AND ` + isFile + `
+		GROUP BY file_size
+		HAVING COUNT(*) > 1
+	)
+	ORDER BY file_size DESC, file_path`
+
+func querySizeCollisions(db *sql.DB, name string) ([]FileInfo, error) {
+	rows, err := db.Query(fmt.Sprintf(sizeCollisionsQuery, name))
+	if err != nil {
+		return nil, fmt.Errorf("error querying same-size files: %v", err)
+	}
+	defer rows.Close()
+
+	var files []FileInfo
+	for rows.Next() {
+		var file FileInfo
+		var filePath sql.NullString
+		err := rows.Scan(&file.FileName, &filePath, &file.PathHash, &file.FileSize, &file.ModTime, &file.ContentHash)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning file row: %v", err)
+		}
+		file.FilePath = filePath.String
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// lookupChunkSize keeps IN lists well under every backend's parameter limit.
+const lookupChunkSize = 500
+
+// queryFileStates looks up path hashes in chunks. placeholder renders the
+// backend's syntax for the i-th (1-based) positional parameter.
+func queryFileStates(db *sql.DB, name string, pathHashes []string, placeholder func(i int) string) (map[string]FileState, error) {
+	states := make(map[string]FileState, len(pathHashes))
+	for start := 0; start < len(pathHashes); start += lookupChunkSize {
+		end := start + lookupChunkSize
+		if end > len(pathHashes) {
+			end = len(pathHashes)
+		}
+		chunk := pathHashes[start:end]
+
+		placeholders := make([]string, len(chunk))
+		args := make([]interface{}, len(chunk))
+		for i, pathHash := range chunk {
+			placeholders[i] = placeholder(i + 1)
+			args[i] = pathHash
+		}
+		query := fmt.Sprintf("SELECT path_hash, file_size, mod_time, CASE WHEN depth IS NULL THEN 1 ELSE 0 END FROM %s WHERE path_hash IN (%s)",
+			name, strings.Join(placeholders, ", "))
+
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up files: %v", err)
+		}
+		for rows.Next() {
+			var pathHash string
+			var state FileState
+			if err := rows.Scan(&pathHash, &state.FileSize, &state.ModTime, &state.Outdated); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error scanning file state: %v", err)
+			}
+			states[pathHash] = state
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error looking up files: %v", err)
+		}
+	}
+	return states, nil
+}
+
+// touchFileRows sets last_seen on the given path hashes in chunks, using the
+// same placeholder convention as queryFileStates.
+func touchFileRows(db *sql.DB, name string, pathHashes []string, seenAt time.Time, placeholder func(i int) string) error {
+	for start := 0; start < len(pathHashes); start += lookupChunkSize {
+		end := start + lookupChunkSize
+		if end > len(pathHashes) {
+			end = len(pathHashes)
+		}
+		chunk := pathHashes[start:end]
+
+		placeholders := make([]string, len(chunk))
+		args := make([]interface{}, 0, len(chunk)+1)
+		args = append(args, seenAt)
+		for i, pathHash := range chunk {
+			placeholders[i] = placeholder(i + 2)
+			args = append(args, pathHash)
+		}
+		query := fmt.Sprintf("UPDATE %s SET last_seen = %s, deleted_at = NULL WHERE path_hash IN (%s)",
+			name, placeholder(1), strings.Join(placeholders, ", "))
+		if _, err := db.Exec(query, args...); err != nil {
+			return fmt.Errorf("error updating last seen time: %v", err)
+		}
+	}
+	return nil
+}
+
+// deletionCountQuery counts the rows a deletion will change, and the files
+// and bytes among them for its summary.
+const deletionCountQuery = `SELECT COUNT(*),
+	COALESCE(SUM(CASE WHEN ` + isFile + ` THEN 1 ELSE 0 END), 0),
+	COALESCE(SUM(CASE WHEN ` + isFile + ` THEN file_size ELSE 0 END), 0)
+	FROM %s WHERE %s`
+
+// markUnseenRows flags or purges the rows under rootPath whose last_seen is
+// older than seenAt. Rows written before last_seen existed have none and
+// count as unseen. The summary covers the rows changed by this call, so
+// files already flagged by an earlier scan are only counted again by purge.
+func markUnseenRows(db *sql.DB, name, rootPath string, seenAt time.Time, purge bool, placeholder func(i int) string) (DeletionSummary, error) {
+	var summary DeletionSummary
+	condition := fmt.Sprintf(`(last_seen IS NULL OR last_seen < %s) AND file_path LIKE %s ESCAPE '\'`,
+		placeholder(1), placeholder(2))
+	if !purge {
+		condition += " AND deleted_at IS NULL"
+	}
+	args := []interface{}{seenAt, likePrefix(rootPath)}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return summary, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var rows int64
+	query := fmt.Sprintf(deletionCountQuery, name, condition)
+	if err := tx.QueryRow(query, args...).Scan(&rows, &summary.Files, &summary.Bytes); err != nil {
+		return summary, fmt.Errorf("error counting deleted files: %v", err)
+	}
+	if rows == 0 {
+		return summary, nil
+	}
+
+	if purge {
+		query = fmt.Sprintf("DELETE FROM %s WHERE %s", name, condition)
+	} else {
+		query = fmt.Sprintf("UPDATE %s SET deleted_at = %s WHERE %s", name, placeholder(3), condition)
+		args = append(args, time.Now().UTC().Truncate(time.Millisecond))
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return summary, fmt.Errorf("error marking deleted files: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return summary, fmt.Errorf("error committing deleted files: %v", err)
+	}
+	return summary, nil
+}
+
+// markDeletedRows is MarkDeleted for the SQL backends. Every path is matched
+// both exactly and as a directory prefix, since a removed directory is
+// reported once rather than file by file.
+func markDeletedRows(db *sql.DB, name string, paths []string, purge bool, placeholder func(i int) string) (DeletionSummary, error) {
+	var summary DeletionSummary
+	if len(paths) == 0 {
+		return summary, nil
+	}
+	condition := fmt.Sprintf(`(file_path = %s OR file_path LIKE %s ESCAPE '\')`, placeholder(1), placeholder(2))
+	if !purge {
+		condition += " AND deleted_at IS NULL"
+	}
+	countQuery := fmt.Sprintf(deletionCountQuery, name, condition)
+	markQuery := fmt.Sprintf("UPDATE %s SET deleted_at = %s WHERE %s", name, placeholder(3), condition)
+	if purge {
+		markQuery = fmt.Sprintf("DELETE FROM %s WHERE %s", name, condition)
+	}
+	deletedAt := time.Now().UTC().Truncate(time.Millisecond)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return summary, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, path := range paths {
+		args := []interface{}{path, likePrefix(path)}
+		var rows, files, bytes int64
+		if err := tx.QueryRow(countQuery, args...).Scan(&rows, &files, &bytes); err != nil {
+			return summary, fmt.Errorf("error counting deleted files: %v", err)
+		}
+		if rows == 0 {
+			continue
+		}
+		if !purge {
+			args = append(args, deletedAt)
+		}
+		if _, err := tx.Exec(markQuery, args...); err != nil {
+			return summary, fmt.Errorf("error marking deleted files: %v", err)
+		}
+		summary.Files += files
+		summary.Bytes += bytes
+	}
+
+	if err := tx.Commit(); err != nil {
+		return summary, fmt.Errorf("error committing deleted files: %v", err)
+	}
+	return summary, nil
+}
+
+// subtreeQuery walks the directory rows below a directory through
+// parent_path_hash and totals the files in them. The recursive CTE is
+// introduced by withRecursive, which SQL Server spells "WITH", and the
+// statement ends with the backend's hint, if any.
+const subtreeQuery = `%[1]s dirs (path_hash) AS (
+		SELECT CAST(%[3]s AS VARCHAR(64))
+		UNION ALL
+		SELECT child.path_hash FROM %[2]s child
+		JOIN dirs ON child.parent_path_hash = dirs.path_hash
+		WHERE ` + isDirectory + ` AND deleted_at IS NULL
+	)
+	SELECT COUNT(*), COALESCE(SUM(file_size), 0)
+	FROM %[2]s f JOIN dirs ON f.parent_path_hash = dirs.path_hash
+	WHERE ` + isFile + ` AND deleted_at IS NULL%[4]s`
+
+// subtreeTotals is SubtreeTotals for the SQL backends. Files written before
+// parent_path_hash existed are not found until a scan rewrites them.
+func subtreeTotals(db *sql.DB, name, path, withRecursive, hint string, placeholder func(i int) string) (int64, int64, error) {
+	query := fmt.Sprintf(subtreeQuery, withRecursive, name, placeholder(1), hint)
+	var files, bytes int64
+	if err := db.QueryRow(query, pathHash(filepath.Clean(path))).Scan(&files, &bytes); err != nil {
+		return 0, 0, fmt.Errorf("error totalling directory: %v", err)
+	}
+	return files, bytes, nil
+}
+
+// listChildren is ListChildren for the SQL backends.
+func listChildren(db *sql.DB, name, path string, placeholder func(i int) string) ([]FileInfo, error) {
+	query := fmt.Sprintf(`
+	SELECT %s FROM %s
+	WHERE parent_path_hash = %s AND deleted_at IS NULL
+	ORDER BY is_dir DESC, file_name`, listColumns, name, placeholder(1))
+	rows, err := db.Query(query, pathHash(filepath.Clean(path)))
+	if err != nil {
+		return nil, fmt.Errorf("error listing directory: %v", err)
+	}
+	defer rows.Close()
+	return scanListedFiles(rows)
+}
+
+// listColumns are the columns read back to list files, in the order
+// scanListedFiles expects.
+const listColumns = `file_name, file_path, path_hash, COALESCE(parent_path_hash, ''), file_size, mod_time,
+	COALESCE(extension, ''), COALESCE(content_hash, ''), COALESCE(mime_type, ''), is_dir, file_count,
+	COALESCE(depth, 0)`
+
+func scanListedFiles(rows *sql.Rows) ([]FileInfo, error) {
+	var files []FileInfo
+	for rows.Next() {
+		var file FileInfo
+		var filePath sql.NullString
+		err := rows.Scan(&file.FileName, &filePath, &file.PathHash, &file.ParentHash, &file.FileSize, &file.ModTime,
+			&file.Extension, &file.ContentHash, &file.MIMEType, &file.IsDir, &file.FileCount, &file.Depth)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning file row: %v", err)
+		}
+		file.FilePath = filePath.String
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// streamFiles is StreamFiles for the SQL backends.
+func streamFiles(db *sql.DB, name, root string, fn func(FileInfo) error, placeholder func(i int) string) error {
+	query := fmt.Sprintf(`
+	SELECT file_name, file_path, path_hash, file_size, mod_time, COALESCE(other_metadata, ''),
+		COALESCE(extension, ''), COALESCE(content_hash, ''), last_seen, COALESCE(mime_type, ''), mime_mismatch,
+		COALESCE(parent_path_hash, ''), is_dir, file_count, COALESCE(depth, 0)
+	FROM %s WHERE deleted_at IS NULL`, name)
+	var args []interface{}
+	if root != "" {
+		root = filepath.Clean(root)
+		query += fmt.Sprintf(` AND (file_path = %s OR file_path LIKE %s ESCAPE '\')`, placeholder(1), placeholder(2))
+		args = append(args, root, likePrefix(root))
+	}
+	rows, err := db.Query(query+" ORDER BY file_path", args...)
+	if err != nil {
+		return fmt.Errorf("error reading catalog: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var file FileInfo
+		var filePath sql.NullString
+		var lastSeen sql.NullTime
+		err := rows.Scan(&file.FileName, &filePath, &file.PathHash, &file.FileSize, &file.ModTime,
+			&file.OtherMetadata, &file.Extension, &file.ContentHash, &lastSeen, &file.MIMEType, &file.MIMEMismatch,
+			&file.ParentHash, &file.IsDir, &file.FileCount, &file.Depth)
+		if err != nil {
+			return fmt.Errorf("error scanning file row: %v", err)
+		}
+		file.FilePath = filePath.String
+		file.LastSeen = lastSeen.Time
+		if err := fn(file); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading catalog: %v", err)
+	}
+	return nil
+}
+
+// likePrefix returns a LIKE pattern, escaped with a backslash, that matches
+// every path below root.
+func likePrefix(root string) string {
+	root = filepath.Clean(root)
+	if !strings.HasSuffix(root, string(filepath.Separator)) {
+		root += string(filepath.Separator)
+	}
+	return escapeLike(root) + "%"
+}
+
+// likeEscaper escapes the LIKE wildcards, and the brackets SQL Server also
+// treats as one, with a backslash.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`, `[`, `\[`)
+
+// escapeLike makes s match literally in a LIKE pattern with ESCAPE '\'.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// sameModTime compares modification times by wall clock at microsecond
+// precision. Catalogs store mod_time without a time zone and some with less
+// precision than the file system, so values read back keep the wall clock
+// but lose the location and the last digits.
+func sameModTime(stored, current time.Time) bool {
+	wallClock := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(),
+			t.Nanosecond(), time.UTC).Truncate(time.Microsecond)
+	}
+	return wallClock(stored).Equal(wallClock(current))
+}
+
+// nullTime maps the zero time to NULL for optional columns.
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// nullString maps empty strings to NULL for optional columns.
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SQL Server encryption modes.
+const (
+	encryptDefault   = ""          // the driver's default: the login is encrypted, the server certificate not checked
+	encryptDisable   = "disable"   // nothing is encrypted
+	encryptMandatory = "mandatory" // everything is encrypted and the server certificate checked
+	encryptStrict    = "strict"    // TDS 8.0: the connection starts with TLS, and the certificate is always checked
+)
+
+var encryptModes = []string{encryptDisable, encryptMandatory, encryptStrict}
+
+// mssqlTLSParams adds the connection string parameters of the encryption
+// settings of cfg to query. Certificate settings need mandatory or strict
+// encryption: otherwise the server may not use TLS at all, and they would
+// silently go unchecked.
+func mssqlTLSParams(cfg ConnectionConfig, query url.Values) error {
+	switch cfg.Encrypt {
+	case encryptDefault, encryptDisable:
+		if cfg.TrustServerCert || cfg.TLSCA != "" || cfg.TLSHostname != "" || cfg.TLSPin != "" {
+			return fmt.Errorf("certificate settings need mandatory or strict encryption")
+		}
+		if cfg.Encrypt == encryptDisable {
+			query.Set("encrypt", encryptDisable)
+		}
+		return nil
+	case encryptMandatory, encryptStrict:
+	default:
+		return fmt.Errorf("unknown encryption mode %q; use one of %s", cfg.Encrypt, strings.Join(encryptModes, ", "))
+	}
+
+	if cfg.TrustServerCert && cfg.Encrypt == encryptStrict {
+		return fmt.Errorf("strict encryption always checks the server certificate; give its CA bundle instead of trusting it")
+	}
+	query.Set("encrypt", cfg.Encrypt)
+	query.Set("trustservercertificate", strconv.FormatBool(cfg.TrustServerCert))
+	if cfg.TLSCA != "" {
+		query.Set("certificate", cfg.TLSCA)
+	}
+	if cfg.TLSHostname != "" {
+		query.Set("hostnameincertificate", cfg.TLSHostname)
+	}
+	return nil
+}
+
+// parseCertificatePins reads a comma-separated list of SHA-256 certificate
+// fingerprints in hex, with or without the colons openssl prints, e.g. the
+// output of "openssl x509 -noout -fingerprint -sha256". Listing more than
+// one lets a certificate be replaced without an outage.
+func parseCertificatePins(list string) ([]string, error) {
+	var pins []string
+	for _, pin := range strings.Split(list, ",") {
+		pin = strings.TrimSpace(pin)
+		pin = strings.TrimPrefix(strings.ToLower(pin), "sha256 fingerprint=")
+		pin = strings.ReplaceAll(pin, ":", "")
+		if pin == "" {
+			continue
+		}
+		if decoded, err := hex.DecodeString(pin); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("invalid certificate fingerprint %q; expected a SHA-256 fingerprint in hex", pin)
+		}
+		pins = append(pins, pin)
+	}
+	if len(pins) == 0 {
+		return nil, fmt.Errorf("no certificate fingerprints given")
+	}
+	return pins, nil
+}
+
+var errCertificateNotPinned = errors.New("server certificate is not pinned")
+
+// verifyCertificatePins returns a TLS connection check that accepts only a
+// server certificate with one of the pinned fingerprints.
+func verifyCertificatePins(pins []string) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errCertificateNotPinned
+		}
+		sum := sha256.Sum256(state.PeerCertificates[0].Raw)
+		fingerprint := hex.EncodeToString(sum[:])
+		if containsString(pins, fingerprint) {
+			return nil
+		}
+		return fmt.Errorf("%v: its SHA-256 fingerprint is %s", errCertificateNotPinned, fingerprint)
+	}
+}
+
+// isCertificateError reports whether a connection failed because the
+// server certificate did not pass validation. The driver does not always
+// wrap the TLS error, so its message is checked as well.
+func isCertificateError(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	if errors.As(err, &verifyErr) || errors.Is(err, errCertificateNotPinned) {
+		return true
+	}
+	message := err.Error()
+	return strings.Contains(message, "TLS Handshake failed") &&
+		(strings.Contains(message, "certificate") || strings.Contains(message, errCertificateNotPinned.Error()))
+}
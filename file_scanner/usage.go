@@ -0,0 +1,214 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UsageGroup is one row of a disk usage breakdown.
+type UsageGroup struct {
+	Label string
+	Files int64
+	Bytes int64
+}
+
+// Breakdowns offered by CatalogReader.UsageBreakdown.
+const (
+	breakdownExtension = "extension"
+	breakdownAge       = "age"
+	breakdownOwner     = "owner"
+)
+
+// ageBuckets group files by modification time, newest first. Each bucket
+// holds the files modified since its cutoff and before the previous one.
+var ageBuckets = []struct {
+	label  string
+	cutoff func(now time.Time) time.Time
+}{
+	{"Under 1 month", func(now time.Time) time.Time { return now.AddDate(0, -1, 0) }},
+	{"1 to 6 months", func(now time.Time) time.Time { return now.AddDate(0, -6, 0) }},
+	{"6 to 12 months", func(now time.Time) time.Time { return now.AddDate(-1, 0, 0) }},
+	{"1 to 3 years", func(now time.Time) time.Time { return now.AddDate(-3, 0, 0) }},
+	{"Over 3 years", nil},
+}
+
+// noLabel stands for files without an extension or a known owner.
+const noLabel = "(none)"
+
+// usageBreakdown is UsageBreakdown for the SQL backends. ownerExpr is the
+// backend's expression for the owner recorded in other_metadata, which must
+// yield NULL rather than fail for rows that hold no JSON.
+func usageBreakdown(db *sql.DB, name, path, by, ownerExpr string, placeholder func(i int) string) ([]UsageGroup, error) {
+	var keyExpr string
+	var args []interface{}
+	switch by {
+	case breakdownExtension:
+		keyExpr = "LOWER(extension)"
+	case breakdownOwner:
+		keyExpr = ownerExpr
+	case breakdownAge:
+		// mod_time holds the local wall-clock time: SQL Server and
+		// PostgreSQL store it without a time zone, and SQLite stores it as
+		// text with the local offset after it, so rows compare by wall
+		// clock on every backend. The cutoffs are local times to match.
+		now := time.Now()
+		var cases []string
+		for i, bucket := range ageBuckets {
+			if bucket.cutoff == nil {
+				break
+			}
+			args = append(args, bucket.cutoff(now))
+			cases = append(cases, fmt.Sprintf("WHEN mod_time >= %s THEN '%d'", placeholder(len(args)), i))
+		}
+		keyExpr = fmt.Sprintf("CASE %s ELSE '%d' END", strings.Join(cases, " "), len(ageBuckets)-1)
+	default:
+		return nil, fmt.Errorf("unknown breakdown %q", by)
+	}
+	args = append(args, likePrefix(path))
+
+	query := fmt.Sprintf(`
+	SELECT usage_key, COUNT(*), COALESCE(SUM(file_size), 0) FROM (
+		SELECT %s AS usage_key, file_size FROM %s
+		WHERE %s AND deleted_at IS NULL AND file_path LIKE %s ESCAPE '\'
+	) grouped
+	GROUP BY usage_key`, keyExpr, name, isFile, placeholder(len(args)))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying usage by %s: %v", by, err)
+	}
+	defer rows.Close()
+
+	var groups []UsageGroup
+	for rows.Next() {
+		var key sql.NullString
+		var group UsageGroup
+		if err := rows.Scan(&key, &group.Files, &group.Bytes); err != nil {
+			return nil, fmt.Errorf("error scanning usage row: %v", err)
+		}
+		group.Label = key.String
+		if by == breakdownAge {
+			if i, err := strconv.Atoi(key.String); err == nil && i >= 0 && i < len(ageBuckets) {
+				group.Label = ageBuckets[i].label
+			}
+		}
+		if group.Label == "" {
+			group.Label = noLabel
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying usage by %s: %v", by, err)
+	}
+
+	if by == breakdownAge {
+		order := make(map[string]int, len(ageBuckets))
+		for i, bucket := range ageBuckets {
+			order[bucket.label] = i
+		}
+		sort.Slice(groups, func(i, j int) bool { return order[groups[i].Label] < order[groups[j].Label] })
+	} else {
+		sortUsage(groups)
+	}
+	return groups, nil
+}
+
+// sortUsage orders groups by size, largest first.
+func sortUsage(groups []UsageGroup) {
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Bytes != groups[j].Bytes {
+			return groups[i].Bytes > groups[j].Bytes
+		}
+		return groups[i].Label < groups[j].Label
+	})
+}
+
+// treemapRect is a tile of a treemap, in the units of the area laid out.
+type treemapRect struct {
+	X, Y, W, H float64
+}
+
+func (r treemapRect) contains(x, y float64) bool {
+	return x >= r.X && x < r.X+r.W && y >= r.Y && y < r.Y+r.H
+}
+
+// layoutTreemap splits area into one tile per value, each with an area in
+// proportion to its value, using the squarified algorithm of Bruls, Huizing
+// and van Wijk so tiles stay close to square. values must be sorted largest
+// first; zero and negative values get empty tiles.
+func layoutTreemap(values []float64, area treemapRect) []treemapRect {
+	tiles := make([]treemapRect, len(values))
+	var total float64
+	n := 0
+	for _, value := range values {
+		if value <= 0 {
+			break
+		}
+		total += value
+		n++
+	}
+	if total == 0 || area.W <= 0 || area.H <= 0 {
+		return tiles
+	}
+
+	scale := area.W * area.H / total
+	areas := make([]float64, n)
+	for i := range areas {
+		areas[i] = values[i] * scale
+	}
+
+	for start := 0; start < n; {
+		side := math.Min(area.W, area.H)
+		end := start + 1
+		for end < n && worstRatio(areas[start:end+1], side) <= worstRatio(areas[start:end], side) {
+			end++
+		}
+
+		var rowArea float64
+		for _, a := range areas[start:end] {
+			rowArea += a
+		}
+		// The row runs along the shorter side of what is left.
+		if area.W >= area.H {
+			width := rowArea / area.H
+			y := area.Y
+			for i := start; i < end; i++ {
+				height := areas[i] / width
+				tiles[i] = treemapRect{area.X, y, width, height}
+				y += height
+			}
+			area.X += width
+			area.W -= width
+		} else {
+			height := rowArea / area.W
+			x := area.X
+			for i := start; i < end; i++ {
+				width := areas[i] / height
+				tiles[i] = treemapRect{x, area.Y, width, height}
+				x += width
+			}
+			area.Y += height
+			area.H -= height
+		}
+		start = end
+	}
+	return tiles
+}
+
+// worstRatio is the largest aspect ratio among tiles of the given areas laid
+// out in a row along side.
+func worstRatio(row []float64, side float64) float64 {
+	var sum, largest float64
+	smallest := math.Inf(1)
+	for _, a := range row {
+		sum += a
+		largest = math.Max(largest, a)
+		smallest = math.Min(smallest, a)
+	}
+	side2, sum2 := side*side, sum*sum
+	return math.Max(side2*largest/sum2, sum2/(side2*smallest))
+}
@@ -3,10 +3,10 @@ package main
 import (
 	"encoding/gob"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
-
-	"fyne.io/fyne/v2/widget"
+	"strconv"
 )
 
 func getAppDataDir() (string, error) {
@@ -101,63 +101,236 @@ func deleteScanState() error {
 	return nil
 }
 
-// Functions to save and load credentials
-func saveCredentials(ipEntry, portEntry, usernameEntry, passwordEntry, dbNameEntry *widget.Entry) error {
+// saveScanProfile remembers the scan options last used in the GUI.
+func saveScanProfile(opts ScanOptions) error {
 	appDataDir, err := getAppDataDir()
 	if err != nil {
 		return fmt.Errorf("error getting app data directory: %v", err)
 	}
-	credentialsPath := filepath.Join(appDataDir, "credentials.gob")
 
-	file, err := os.Create(credentialsPath)
+	file, err := os.Create(filepath.Join(appDataDir, "scan_profile.gob"))
 	if err != nil {
-		return fmt.Errorf("error creating credentials file: %v", err)
+		return fmt.Errorf("error creating scan profile file: %v", err)
 	}
 	defer file.Close()
 
-	credentials := map[string]string{
-		"ip":       ipEntry.Text,
-		"port":     portEntry.Text,
-		"username": usernameEntry.Text,
-		"password": passwordEntry.Text,
-		"dbname":   dbNameEntry.Text,
-	}
-
-	encoder := gob.NewEncoder(file)
-	err = encoder.Encode(credentials)
-	if err != nil {
-		return fmt.Errorf("error encoding credentials: %v", err)
+	if err := gob.NewEncoder(file).Encode(opts); err != nil {
+		return fmt.Errorf("error encoding scan profile: %v", err)
 	}
 	return nil
 }
 
-func loadCredentials(ipEntry, portEntry, usernameEntry, passwordEntry, dbNameEntry *widget.Entry) error {
+func loadScanProfile() (ScanOptions, error) {
 	appDataDir, err := getAppDataDir()
 	if err != nil {
-		return fmt.Errorf("error getting app data directory: %v", err)
+		return ScanOptions{}, fmt.Errorf("error getting app data directory: %v", err)
 	}
-	credentialsPath := filepath.Join(appDataDir, "credentials.gob")
 
-	file, err := os.Open(credentialsPath)
+	file, err := os.Open(filepath.Join(appDataDir, "scan_profile.gob"))
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil // It's okay if the file doesn't exist
+			return ScanOptions{}, nil // It's okay if the file doesn't exist
 		}
-		return fmt.Errorf("error opening credentials file: %v", err)
+		return ScanOptions{}, fmt.Errorf("error opening scan profile file: %v", err)
 	}
 	defer file.Close()
 
-	decoder := gob.NewDecoder(file)
-	credentials := make(map[string]string)
-	err = decoder.Decode(&credentials)
+	var opts ScanOptions
+	if err := gob.NewDecoder(file).Decode(&opts); err != nil {
+		return ScanOptions{}, fmt.Errorf("error decoding scan profile: %v", err)
+	}
+	return opts, nil
+}
+
+// Functions to save and load credentials
+
+// saveCredentials saves the connection settings as the named profile and
+// makes it the one used next. The password goes where passwordStore says:
+// to the keyring, into the profile encrypted with passphrase, or nowhere.
+// It is never written in plain text.
+func saveCredentials(profile string, cfg ConnectionConfig, passwordStore, passphrase string) error {
+	if err := checkProfileName(profile); err != nil {
+		return err
+	}
+
+	credentials := map[string]string{
+		"backend":        cfg.Backend,
+		"ip":             cfg.Server,
+		"port":           cfg.Port,
+		"username":       cfg.Username,
+		"dbname":         cfg.Database,
+		"password_store": passwordStore,
+	}
+	if cfg.Auth != "" {
+		credentials["auth"] = cfg.Auth
+		credentials["realm"] = cfg.Realm
+		credentials["krb5_config"] = cfg.Krb5Config
+		credentials["keytab"] = cfg.Keytab
+		credentials["tenant_id"] = cfg.TenantID
+	}
+	if cfg.Encrypt != "" {
+		credentials["encrypt"] = cfg.Encrypt
+		credentials["trust_server_cert"] = strconv.FormatBool(cfg.TrustServerCert)
+		credentials["tls_ca"] = cfg.TLSCA
+		credentials["tls_hostname"] = cfg.TLSHostname
+		credentials["tls_pin"] = cfg.TLSPin
+	}
+	if cfg.SSLMode != "" {
+		credentials["sslmode"] = cfg.SSLMode
+	}
+	if cfg.Backend == "files" {
+		credentials["file_format"] = cfg.FileFormat
+		credentials["compression"] = cfg.Compression
+		credentials["rotate_size"] = strconv.FormatInt(cfg.RotateSize, 10)
+	}
+	var err error
+	switch passwordStore {
+	case passwordKeyring:
+		if err := passwordKeyringStore.Set(profile, cfg.Password); err != nil {
+			return err
+		}
+	case passwordVault:
+		if passphrase == "" {
+			return fmt.Errorf("no master password given")
+		}
+		credentials["vault_salt"], credentials["vault_password"], err = sealPassword(cfg.Password, passphrase)
+		if err != nil {
+			return err
+		}
+	case passwordNone:
+	default:
+		return fmt.Errorf("unknown password store %q", passwordStore)
+	}
+	if passwordStore != passwordKeyring {
+		// Don't leave a password behind that is no longer meant to be kept.
+		if err := passwordKeyringStore.Delete(profile); err != nil {
+			log.Printf("Error removing saved password: %v", err)
+		}
+	}
+
+	profiles, err := readProfiles()
 	if err != nil {
-		return fmt.Errorf("error decoding credentials: %v", err)
+		return err
 	}
+	profiles.Profiles[profile] = credentials
+	profiles.Current = profile
+	return writeProfiles(profiles)
+}
 
-	ipEntry.SetText(credentials["ip"])
-	portEntry.SetText(credentials["port"])
-	usernameEntry.SetText(credentials["username"])
-	passwordEntry.SetText(credentials["password"])
-	dbNameEntry.SetText(credentials["dbname"])
-	return nil
+// loadCredentials returns the connection settings of the named profile, or
+// of the one used last when profile is empty, and where the password is
+// kept. A password in the keyring is read from it, and one in the vault is
+// decrypted with passphrase. Without a passphrase the vault stays locked and
+// the password empty, so callers can ask for one and load again. A plain
+// text password saved by an older version is returned and moved out of the
+// file by movePlaintextPassword.
+func loadCredentials(profile, passphrase string) (ConnectionConfig, string, error) {
+	profiles, err := readProfiles()
+	if err != nil {
+		return ConnectionConfig{}, "", err
+	}
+	if profile == "" {
+		profile = profiles.Current
+	}
+	credentials, ok := profiles.Profiles[profile]
+	if !ok {
+		if profile != profiles.Current {
+			return ConnectionConfig{}, "", fmt.Errorf("no profile named %q", profile)
+		}
+		return ConnectionConfig{}, "", nil // Nothing saved yet
+	}
+
+	rotateSize, _ := strconv.ParseInt(credentials["rotate_size"], 10, 64)
+	trustServerCert, _ := strconv.ParseBool(credentials["trust_server_cert"])
+	cfg := ConnectionConfig{
+		Backend:         credentials["backend"],
+		Server:          credentials["ip"],
+		Port:            credentials["port"],
+		Username:        credentials["username"],
+		Database:        credentials["dbname"],
+		FileFormat:      credentials["file_format"],
+		Compression:     credentials["compression"],
+		RotateSize:      rotateSize,
+		Auth:            credentials["auth"],
+		Realm:           credentials["realm"],
+		Krb5Config:      credentials["krb5_config"],
+		Keytab:          credentials["keytab"],
+		TenantID:        credentials["tenant_id"],
+		Encrypt:         credentials["encrypt"],
+		TrustServerCert: trustServerCert,
+		TLSCA:           credentials["tls_ca"],
+		TLSHostname:     credentials["tls_hostname"],
+		TLSPin:          credentials["tls_pin"],
+		SSLMode:         credentials["sslmode"],
+	}
+
+	passwordStore := credentials["password_store"]
+	switch passwordStore {
+	case passwordKeyring:
+		if cfg.Password, err = passwordKeyringStore.Get(profile); err != nil {
+			// The rest of the settings are still worth having.
+			log.Printf("Error loading saved password: %v", err)
+		}
+	case passwordVault:
+		if passphrase != "" {
+			cfg.Password, err = openPassword(credentials["vault_salt"], credentials["vault_password"], passphrase)
+			if err != nil {
+				return ConnectionConfig{}, "", err
+			}
+		}
+	case "":
+		cfg.Password = credentials["password"]
+		passwordStore = movePlaintextPassword(profile, credentials, passphrase)
+		profiles.Profiles[profile] = credentials
+		if err := writeProfiles(profiles); err != nil {
+			log.Printf("Error saving migrated credentials: %v", err)
+			return cfg, "", nil
+		}
+		log.Printf("Migrated saved credentials to password store %q", passwordStore)
+	}
+	return cfg, passwordStore, nil
+}
+
+// movePlaintextPassword takes the plain text password out of credentials
+// saved by an older version and puts it in the keyring or, when that is
+// unavailable and passphrase is set, in the vault. When neither works the
+// password is dropped, and has to be entered again, rather than left in
+// the file. It returns where the password went.
+func movePlaintextPassword(profile string, credentials map[string]string, passphrase string) string {
+	password := credentials["password"]
+	delete(credentials, "password")
+	if password == "" {
+		credentials["password_store"] = passwordNone
+		return passwordNone
+	}
+
+	passwordStore := passwordKeyring
+	err := passwordKeyringStore.Set(profile, password)
+	if err != nil && passphrase != "" {
+		log.Printf("Encrypting the saved password with the master password instead: %v", err)
+		passwordStore = passwordVault
+		credentials["vault_salt"], credentials["vault_password"], err = sealPassword(password, passphrase)
+	}
+	if err != nil {
+		log.Printf("Warning: removed the plain text password of profile '%s'; enter it again to save it: %v", profile, err)
+		passwordStore = passwordNone
+		delete(credentials, "vault_salt")
+		delete(credentials, "vault_password")
+	}
+	credentials["password_store"] = passwordStore
+	return passwordStore
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. "1.5 GB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
 }
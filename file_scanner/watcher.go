@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchFlushInterval is how long watch mode collects events before applying
+// them, so a burst of writes to one file becomes a single row update.
+const watchFlushInterval = 2 * time.Second
+
+var watching int32
+
+// IsWatching reports whether watch mode has finished its initial scan and is
+// following changes.
+func IsWatching() bool {
+	return atomic.LoadInt32(&watching) == 1
+}
+
+// watchFolder runs an initial scanFolder pass over folderPath and then keeps
+// the catalog current from file system events until ctx is cancelled. New,
+// modified and renamed files go through the same batch writer as a scan;
+// removed files and directories are marked deleted, or purged. Errors and
+// cancellation during the initial scan are returned as scanFolder returns
+// them; cancelling afterwards ends watch mode and returns nil.
+func watchFolder(ctx context.Context, store Storage, tableName, folderPath string, opts ScanOptions) error {
+	tracker, ok := store.(ChangeTracker)
+	reader, isReader := store.(CatalogReader)
+	if !ok || !isReader {
+		return fmt.Errorf("this storage backend does not support watch mode")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error starting file watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	// Watches are added before the initial scan so that changes made while
+	// it runs are picked up afterwards.
+	events := &watchEvents{paths: make(map[string]bool)}
+	if err := addWatches(watcher, folderPath, folderPath, opts.Filters, nil); err != nil {
+		return err
+	}
+	go events.collect(ctx, watcher, folderPath, opts.Filters)
+
+	if err := scanFolder(ctx, store, tableName, folderPath, opts); err != nil {
+		return err
+	}
+
+	atomic.StoreInt32(&watching, 1)
+	defer atomic.StoreInt32(&watching, 0)
+	log.Printf("Watching %s for changes", folderPath)
+
+	writer := newBatchWriter(store, tableName, opts, newRateLimiter(opts.HashRateLimit))
+	ticker := time.NewTicker(watchFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Stopped watching %s", folderPath)
+			if err := store.Finalize(tableName); err != nil {
+				log.Printf("Error finalizing watch: %v", err)
+				return fmt.Errorf("error finalizing watch: %v", err)
+			}
+			return nil
+		case <-ticker.C:
+		}
+		if paused {
+			continue
+		}
+
+		paths, rescan := events.take()
+		if rescan {
+			// The event queue overflowed, so some changes are unknown. An
+			// incremental rescan finds them and the deleted files.
+			log.Printf("File watcher dropped events; rescanning %s", folderPath)
+			scanStateLock.Lock()
+			scanState.FilesScanned = make(map[string]bool)
+			scanStateLock.Unlock()
+			rescanOpts := opts
+			rescanOpts.Incremental = true
+			if err := scanFolder(ctx, store, tableName, folderPath, rescanOpts); err != nil {
+				if ctx.Err() != nil {
+					continue
+				}
+				return err
+			}
+			continue
+		}
+		if len(paths) == 0 {
+			continue
+		}
+		if err := applyWatchEvents(ctx, writer, tracker, reader, folderPath, paths); err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			log.Printf("Error applying file changes: %v", err)
+			return fmt.Errorf("error applying file changes: %v", err)
+		}
+	}
+}
+
+// applyWatchEvents brings the catalog rows of the given paths up to date
+// with what is on disk now, then the directory rows above them. Files the
+// filter rules drop are left alone.
+func applyWatchEvents(ctx context.Context, writer *batchWriter, tracker ChangeTracker, reader CatalogReader, root string, paths []string) error {
+	writer.seenAt = time.Now().UTC().Truncate(time.Millisecond)
+	processOpts := writer.opts.forWorkers()
+
+	var deleted []string
+	written := atomic.LoadInt64(&totalFilesWritten)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			deleted = append(deleted, path)
+			continue
+		}
+		if err != nil {
+			log.Printf("Error getting file info for %s: %v", path, err)
+			continue
+		}
+		if info.IsDir() {
+			continue
+		}
+		filters := writer.opts.Filters
+		if filters.prunedPath(root, path) || !filters.matchName(root, path) {
+			continue
+		}
+
+		fileInfo, err := processFile(ctx, path, processOpts, writer.limiter)
+		if errors.Is(err, errFiltered) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error processing file %s: %v", path, err)
+			continue
+		}
+		atomic.AddInt64(&totalFilesScanned, 1)
+		if err := writer.add(ctx, fileInfo); err != nil {
+			return err
+		}
+	}
+	if err := writer.flush(ctx); err != nil {
+		return err
+	}
+
+	summary, err := tracker.MarkDeleted(writer.tableName, deleted, writer.opts.PurgeDeleted)
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&totalFilesDeleted, summary.Files)
+	atomic.AddInt64(&totalBytesDeleted, summary.Bytes)
+
+	// Every directory above a changed path has new totals.
+	if err := refreshDirectories(writer, reader, root, paths); err != nil {
+		return err
+	}
+
+	log.Printf("Applied %d file changes: %d files written, %d deleted",
+		len(paths), atomic.LoadInt64(&totalFilesWritten)-written, summary.Files)
+	return nil
+}
+
+// watchEvents collects the paths touched by file system events between two
+// flushes. Only the latest state of a path matters, so the event type is
+// dropped and the path is looked up again when the events are applied.
+type watchEvents struct {
+	mu     sync.Mutex
+	paths  map[string]bool
+	rescan bool
+}
+
+func (e *watchEvents) add(path string) {
+	e.mu.Lock()
+	e.paths[path] = true
+	e.mu.Unlock()
+}
+
+// take returns the collected paths in order and starts a new round.
+func (e *watchEvents) take() ([]string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	paths := make([]string, 0, len(e.paths))
+	for path := range e.paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	rescan := e.rescan
+	e.paths = make(map[string]bool)
+	e.rescan = false
+	return paths, rescan
+}
+
+func (e *watchEvents) collect(ctx context.Context, watcher *fsnotify.Watcher, root string, filters FilterRules) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			// fsnotify does not watch recursively, so new directories need
+			// watches of their own. Files may land in them before the watch
+			// is added, so their contents are queued too.
+			if event.Op&fsnotify.Create != 0 {
+				info, err := os.Lstat(event.Name)
+				if err == nil && info.IsDir() && !filters.pruneDir(root, event.Name) && !filters.prunedPath(root, event.Name) {
+					if err := addWatches(watcher, root, event.Name, filters, e.add); err != nil {
+						log.Printf("Error watching new directory: %v", err)
+					}
+				}
+			}
+			e.add(event.Name)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Error watching files: %v", err)
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				e.mu.Lock()
+				e.rescan = true
+				e.mu.Unlock()
+			}
+		}
+	}
+}
+
+// addWatches watches dir and every directory below it that the filter rules
+// do not prune, with patterns relative to the scanned root. found, when set,
+// is called with every file and directory on the way. Only failing to watch
+// dir itself is an error; subdirectories that cannot be watched are logged
+// and skipped.
+func addWatches(watcher *fsnotify.Watcher, root, dir string, filters FilterRules, found func(path string)) error {
+	if err := watcher.Add(dir); err != nil {
+		return fmt.Errorf("error watching %s: %v", dir, err)
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("Error walking directory at %s: %v", path, err)
+			return nil
+		}
+		if path == dir {
+			return nil
+		}
+		if d.IsDir() && filters.pruneDir(root, path) {
+			return filepath.SkipDir
+		}
+		if found != nil {
+			found(path)
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if err := watcher.Add(path); err != nil {
+			log.Printf("Error watching %s: %v", path, err)
+		}
+		return nil
+	})
+}